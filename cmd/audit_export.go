@@ -0,0 +1,72 @@
+package main
+
+import (
+	"Tages/internal/audit"
+	"Tages/internal/dto"
+	"context"
+	"flag"
+	"io"
+	"os"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// выгрузка журнала аудита в JSONL: tages audit-export -from ... -to ... -out audit.jsonl
+func runAuditExport(args []string) error {
+	fs := flag.NewFlagSet("audit-export", flag.ContinueOnError)
+	from := fs.String("from", "", "start of the period, RFC3339 (inclusive)")
+	to := fs.String("to", "", "end of the period, RFC3339 (exclusive)")
+	actor := fs.String("actor", "", "filter by actor")
+	fileName := fs.String("file_name", "", "filter by file name")
+	out := fs.String("out", "", "output file, stdout by default")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	filter := dto.AuditFilter{
+		Actor:    *actor,
+		FileName: *fileName,
+	}
+	var err error
+	if *from != "" {
+		if filter.From, err = time.Parse(time.RFC3339, *from); err != nil {
+			return errors.Wrap(err, "invalid -from")
+		}
+	}
+	if *to != "" {
+		if filter.To, err = time.Parse(time.RFC3339, *to); err != nil {
+			return errors.Wrap(err, "invalid -to")
+		}
+	}
+
+	if err := configure(); err != nil {
+		return err
+	}
+	logger := getLogger()
+	logger.SetOutput(os.Stderr)
+
+	ctx := context.Background()
+	store, err := getStorage(ctx, logger)
+	if err != nil {
+		return err
+	}
+	defer store.Close(ctx)
+
+	var w io.Writer = os.Stdout
+	if *out != "" {
+		f, err := os.Create(*out)
+		if err != nil {
+			return errors.Wrap(err, "cant create output file")
+		}
+		defer f.Close()
+		w = f
+	}
+
+	n, err := audit.ExportJSONL(ctx, store, filter, w)
+	if err != nil {
+		return err
+	}
+	logger.WithField("events", n).Info("Audit log exported")
+	return nil
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// управление схемой БД: tages migrate up | down [-steps N] | status
+func runMigrate(args []string) error {
+	if len(args) == 0 {
+		return errors.New("usage: migrate up | down [-steps N] | status")
+	}
+	cmd := args[0]
+
+	fs := flag.NewFlagSet("migrate "+cmd, flag.ContinueOnError)
+	steps := fs.Int("steps", 1, "number of migrations to revert (down only)")
+	if err := fs.Parse(args[1:]); err != nil {
+		return err
+	}
+
+	if err := configure(); err != nil {
+		return err
+	}
+	logger := getLogger()
+	logger.SetOutput(os.Stderr)
+
+	ctx := context.Background()
+	store, err := openStorage(logger)
+	if err != nil {
+		return err
+	}
+	defer store.Close(ctx)
+
+	m, err := store.Migrator(logger)
+	if err != nil {
+		return err
+	}
+
+	switch cmd {
+	case "up":
+		n, err := m.Up(ctx)
+		if err != nil {
+			return err
+		}
+		logger.WithField("applied", n).Info("Migrations applied")
+	case "down":
+		if *steps < 1 {
+			return errors.New("-steps must be positive")
+		}
+		n, err := m.Down(ctx, *steps)
+		if err != nil {
+			return err
+		}
+		logger.WithField("reverted", n).Info("Migrations reverted")
+	case "status":
+		status, err := m.Status(ctx)
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "VERSION\tNAME\tAPPLIED AT")
+		for _, st := range status {
+			applied := "pending"
+			if st.AppliedAt != nil {
+				applied = st.AppliedAt.Format(time.RFC3339)
+			}
+			fmt.Fprintf(w, "%04d\t%s\t%s\n", st.Version, st.Name, applied)
+		}
+		w.Flush()
+		return err
+	default:
+		return errors.Errorf("unknown command %q, want up, down or status", cmd)
+	}
+	return nil
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"Tages/internal/accesslog"
+	"Tages/internal/cache"
+	"Tages/internal/config"
+	"Tages/internal/ratelimiter"
+	"Tages/internal/service"
+	"context"
+	"reflect"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+)
+
+// настройки, которые применяются без перезапуска
+func newReloader(
+	ctx context.Context,
+	logger *logrus.Logger,
+	accessLog *accesslog.AccessLog,
+	rateLimiter *ratelimiter.RateLimiter,
+	srv *service.ServiceFile,
+	c cache.Tunable,
+	mem *cache.Cache,
+) *config.Reloader {
+	r := config.NewReloader(viper.GetViper(), setDefaults, logger)
+
+	r.Subscribe("log", func(v *viper.Viper) (func(), error) {
+		level, err := logrus.ParseLevel(v.GetString("log.level"))
+		if err != nil {
+			return nil, err
+		}
+		access, err := accesslog.LoadConfig(v)
+		if err != nil {
+			return nil, err
+		}
+		return func() {
+			logger.SetLevel(level)
+			accessLog.SetConfig(access)
+		}, nil
+	})
+
+	r.Subscribe("ratelimiter", func(v *viper.Viper) (func(), error) {
+		policies, err := ratelimiter.LoadPolicies(v)
+		if err != nil {
+			return nil, err
+		}
+		// перезагрузка из-за других разделов лимиты не трогает
+		if reflect.DeepEqual(policies, rateLimiter.Policies()) {
+			return nil, nil
+		}
+		return func() { rateLimiter.SetPolicies(policies) }, nil
+	})
+
+	r.Subscribe("upload", func(v *viper.Viper) (func(), error) {
+		size := v.GetInt64("upload.max_file_size")
+		if size <= 0 {
+			return nil, errors.New("upload.max_file_size must be positive")
+		}
+		return func() { srv.SetMaxFileSize(size) }, nil
+	})
+
+	// включение кеша прогревает его, остальные пустые состояния (давление памяти,
+	// список больше лимитов) перезагрузка не трогает, см. OnRecover
+	cacheEnabled := viper.GetBool("cache.enabled")
+	r.Subscribe("cache", func(v *viper.Viper) (func(), error) {
+		// mem == nil - backend redis
+		if mem == nil {
+			if err := cache.CheckRedisSettings(v); err != nil {
+				return nil, err
+			}
+		}
+		enabled := v.GetBool("cache.enabled")
+		limits, err := cache.LoadLimits(v)
+		if err != nil {
+			return nil, err
+		}
+		pressure, err := cache.LoadPressureConfig(v)
+		if err != nil {
+			return nil, err
+		}
+		content, err := cache.LoadContentLimits(v)
+		if err != nil {
+			return nil, err
+		}
+		return func() {
+			c.SetLimits(limits)
+			if mem != nil {
+				mem.SetPressureConfig(pressure)
+			}
+			srv.SetContentLimits(content)
+			wasEnabled := cacheEnabled
+			cacheEnabled = enabled
+			if !enabled {
+				c.SetEnabled(false)
+				return
+			}
+			if wasEnabled {
+				return
+			}
+			// пока кеш не прогрет, ListFiles читает из БД
+			c.SetEnabled(true)
+			if err := srv.HeatCache(ctx); err != nil {
+				logger.WithError(err).Warn("Failed to warm cache after enabling")
+			}
+		}, nil
+	})
+
+	r.Static(
+		"listen", "metrics", "db.dsn", "db.notify", "db.tx", "db.migrate", "upload.dir", "coalesce",
+		"cache.backend", "cache.redis", "tracing", "health", "shutdown", "admin", "legacy_metrics",
+		"cache.pressure.sample_interval_ms",
+		"ratelimiter.key", "ratelimiter.trusted_proxies", "ratelimiter.api_keys", "ratelimiter.backend",
+	)
+
+	return r
+}
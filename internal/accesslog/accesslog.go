@@ -0,0 +1,192 @@
+package accesslog
+
+import (
+	"context"
+	"math/rand/v2"
+	"net"
+	"sync/atomic"
+	"time"
+
+	"Tages/internal/clientinfo"
+
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+type Config struct {
+	// писать ли строку на каждый вызов
+	Enabled bool
+	// доля успешных вызовов, которые попадают в лог; ошибки пишутся всегда
+	SampleRatio float64
+}
+
+var DefaultConfig = Config{Enabled: true, SampleRatio: 1}
+
+// LoadConfig читает секцию log.access:
+//
+//	log:
+//	  access:
+//	    enabled: true
+//	    sample_ratio: 0.1
+func LoadConfig(v *viper.Viper) (Config, error) {
+	cfg := DefaultConfig
+	if v.IsSet("log.access.enabled") {
+		cfg.Enabled = v.GetBool("log.access.enabled")
+	}
+	if v.IsSet("log.access.sample_ratio") {
+		cfg.SampleRatio = v.GetFloat64("log.access.sample_ratio")
+	}
+	if cfg.SampleRatio < 0 || cfg.SampleRatio > 1 {
+		return Config{}, errors.Errorf("log.access.sample_ratio must be within [0, 1], got %v", cfg.SampleRatio)
+	}
+	return cfg, nil
+}
+
+// AccessLog назначает вызову x-request-id, кладет в контекст логгер с ним
+// и пишет по строке на вызов. identity - аутентифицированный клиент, как в
+// журнале аудита: x-client-id принимается только от trusted прокси.
+type AccessLog struct {
+	logger  *logrus.Logger
+	trusted []*net.IPNet
+	cfg     atomic.Pointer[Config]
+}
+
+func New(cfg Config, logger *logrus.Logger, trusted []*net.IPNet) *AccessLog {
+	a := &AccessLog{logger: logger, trusted: trusted}
+	a.SetConfig(cfg)
+	return a
+}
+
+// SetConfig меняет настройки на лету
+func (a *AccessLog) SetConfig(cfg Config) {
+	a.cfg.Store(&cfg)
+}
+
+// begin готовит контекст вызова: идентификатор, логгер и заголовок ответа
+func (a *AccessLog) begin(ctx context.Context, method string) (context.Context, string) {
+	id := incomingRequestID(ctx)
+	if id == "" {
+		id = uuid.New().String()
+	}
+
+	trace.SpanFromContext(ctx).SetAttributes(attribute.String("request.id", id))
+
+	entry := a.logger.WithFields(logrus.Fields{
+		"request_id": id,
+		"method":     method,
+	})
+	ctx = context.WithValue(ctx, requestIDKey{}, id)
+	return WithLogger(ctx, entry), id
+}
+
+func (a *AccessLog) record(ctx context.Context, err error, start time.Time, in, out int64) {
+	cfg := a.cfg.Load()
+	if !cfg.Enabled {
+		return
+	}
+	code := status.Code(err)
+	if code == codes.OK && cfg.SampleRatio < 1 && rand.Float64() >= cfg.SampleRatio {
+		return
+	}
+
+	entry := FromContext(ctx).WithFields(logrus.Fields{
+		"peer":        clientinfo.Peer(ctx),
+		"identity":    clientinfo.AuthenticatedActor(ctx, a.trusted),
+		"code":        code.String(),
+		"duration_ms": float64(time.Since(start).Microseconds()) / 1000,
+		"bytes_in":    in,
+		"bytes_out":   out,
+	})
+	if err != nil {
+		entry = entry.WithField("error", status.Convert(err).Message())
+	}
+
+	switch code {
+	case codes.OK, codes.NotFound, codes.InvalidArgument, codes.AlreadyExists, codes.Canceled:
+		entry.Info("access")
+	case codes.Internal, codes.Unknown, codes.DataLoss:
+		entry.Error("access")
+	default:
+		entry.Warn("access")
+	}
+}
+
+func (a *AccessLog) UnaryInterceptor() grpc.UnaryServerInterceptor {
+	return func(
+		ctx context.Context,
+		req interface{},
+		info *grpc.UnaryServerInfo,
+		handler grpc.UnaryHandler,
+	) (interface{}, error) {
+		start := time.Now()
+		ctx, id := a.begin(ctx, info.FullMethod)
+		_ = grpc.SetHeader(ctx, metadata.Pairs(RequestIDHeader, id))
+
+		resp, err := handler(ctx, req)
+
+		a.record(ctx, err, start, messageSize(req), messageSize(resp))
+		return resp, err
+	}
+}
+
+func (a *AccessLog) StreamInterceptor() grpc.StreamServerInterceptor {
+	return func(
+		srv interface{},
+		ss grpc.ServerStream,
+		info *grpc.StreamServerInfo,
+		handler grpc.StreamHandler,
+	) error {
+		start := time.Now()
+		ctx, id := a.begin(ss.Context(), info.FullMethod)
+		_ = ss.SetHeader(metadata.Pairs(RequestIDHeader, id))
+
+		stream := &countingStream{ServerStream: ss, ctx: ctx}
+		err := handler(srv, stream)
+
+		a.record(ctx, err, start, stream.in, stream.out)
+		return err
+	}
+}
+
+// countingStream считает размер принятых и отправленных сообщений
+type countingStream struct {
+	grpc.ServerStream
+	ctx     context.Context
+	in, out int64
+}
+
+func (s *countingStream) Context() context.Context {
+	return s.ctx
+}
+
+func (s *countingStream) RecvMsg(m interface{}) error {
+	err := s.ServerStream.RecvMsg(m)
+	if err == nil {
+		s.in += messageSize(m)
+	}
+	return err
+}
+
+func (s *countingStream) SendMsg(m interface{}) error {
+	err := s.ServerStream.SendMsg(m)
+	if err == nil {
+		s.out += messageSize(m)
+	}
+	return err
+}
+
+func messageSize(m interface{}) int64 {
+	if msg, ok := m.(proto.Message); ok && msg != nil {
+		return int64(proto.Size(msg))
+	}
+	return 0
+}
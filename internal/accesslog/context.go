@@ -0,0 +1,69 @@
+package accesslog
+
+import (
+	"context"
+
+	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc/metadata"
+)
+
+// RequestIDHeader - заголовок с идентификатором запроса, берется от клиента
+// или назначается сервером и возвращается в ответе
+const RequestIDHeader = "x-request-id"
+
+// максимальная длина принимаемого от клиента идентификатора
+const maxRequestIDLen = 128
+
+type loggerKey struct{}
+type requestIDKey struct{}
+
+// WithLogger кладет логгер запроса в контекст
+func WithLogger(ctx context.Context, entry *logrus.Entry) context.Context {
+	return context.WithValue(ctx, loggerKey{}, entry)
+}
+
+// FromContext возвращает логгер запроса. Вне запроса - стандартный логгер
+// logrus, чтобы вызывающему не нужно было проверять nil.
+func FromContext(ctx context.Context) *logrus.Entry {
+	if entry, ok := ctx.Value(loggerKey{}).(*logrus.Entry); ok {
+		return entry
+	}
+	return logrus.NewEntry(logrus.StandardLogger())
+}
+
+// FromContextOr - как FromContext, но вне запроса пишет в logger
+func FromContextOr(ctx context.Context, logger *logrus.Logger) *logrus.Entry {
+	if entry, ok := ctx.Value(loggerKey{}).(*logrus.Entry); ok {
+		return entry
+	}
+	return logrus.NewEntry(logger)
+}
+
+// RequestID возвращает идентификатор текущего запроса или пустую строку
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// incomingRequestID берет идентификатор из метаданных, если он похож на
+// идентификатор: непустой, не длиннее maxRequestIDLen, печатные ASCII
+func incomingRequestID(ctx context.Context) string {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return ""
+	}
+	vals := md.Get(RequestIDHeader)
+	if len(vals) == 0 {
+		return ""
+	}
+	id := vals[0]
+	if id == "" || len(id) > maxRequestIDLen {
+		return ""
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] < 0x21 || id[i] > 0x7e {
+			return ""
+		}
+	}
+	return id
+}
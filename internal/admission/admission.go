@@ -0,0 +1,209 @@
+package admission
+
+import (
+	"Tages/internal/metrics"
+	"context"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+type Config struct {
+	// всего одновременных вызовов в пуле
+	Slots int
+	// одновременных вызовов одного клиента, 0 - без ограничения
+	PerClient int
+	// сколько вызов может ждать в очереди
+	QueueTimeout time.Duration
+	// вес клиента в очереди, по умолчанию 1
+	Weights map[string]int
+}
+
+type waiter struct {
+	ready   chan struct{}
+	granted bool
+}
+
+type clientState struct {
+	inUse   int
+	weight  float64
+	virtual float64
+	queue   []*waiter
+}
+
+// Pool - пул слотов с честной очередью между клиентами.
+// Пока слотов нет, вызовы ждут в очереди своего клиента. Освободившийся слот
+// получает клиент с наименьшим виртуальным временем: каждый выданный слот
+// сдвигает его на 1/вес, так клиент с весом 2 обслуживается вдвое чаще.
+type Pool struct {
+	name    string
+	cfg     Config
+	mu      sync.Mutex
+	inUse   int
+	waiting int
+	// виртуальное время последней выдачи, от него стартуют вновь пришедшие
+	virtual float64
+	clients map[string]*clientState
+}
+
+func NewPool(name string, cfg Config) *Pool {
+	if cfg.Slots <= 0 {
+		cfg.Slots = 1
+	}
+	return &Pool{
+		name:    name,
+		cfg:     cfg,
+		clients: make(map[string]*clientState),
+	}
+}
+
+// Acquire занимает слот для клиента. Вызов, не дождавшийся слота за QueueTimeout,
+// получает Unavailable. Возвращаемую функцию нужно вызвать по завершении.
+func (p *Pool) Acquire(ctx context.Context, client string) (func(), error) {
+	p.mu.Lock()
+	c := p.client(client)
+	w := &waiter{ready: make(chan struct{})}
+	c.queue = append(c.queue, w)
+	p.waiting++
+	p.dispatch()
+	p.observe()
+	p.mu.Unlock()
+
+	release := func() { p.release(client) }
+
+	var timeout <-chan time.Time
+	if p.cfg.QueueTimeout > 0 {
+		timer := time.NewTimer(p.cfg.QueueTimeout)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+
+	select {
+	case <-w.ready:
+		return release, nil
+	case <-ctx.Done():
+		if p.abandon(client, w) {
+			return release, nil
+		}
+		metrics.AdmissionRejected.WithLabelValues(p.name, "canceled").Inc()
+		return nil, status.FromContextError(ctx.Err()).Err()
+	case <-timeout:
+		if p.abandon(client, w) {
+			return release, nil
+		}
+		metrics.AdmissionRejected.WithLabelValues(p.name, "timeout").Inc()
+		return nil, status.Error(codes.Unavailable, "server is busy, try again later")
+	}
+}
+
+// abandon убирает ожидающего из очереди, true - слот ему уже выдан
+func (p *Pool) abandon(client string, w *waiter) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if w.granted {
+		return true
+	}
+
+	c := p.clients[client]
+	for i, q := range c.queue {
+		if q == w {
+			c.queue = append(c.queue[:i], c.queue[i+1:]...)
+			break
+		}
+	}
+	p.waiting--
+	p.forget(client, c)
+	p.observe()
+	return false
+}
+
+func (p *Pool) release(client string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	c := p.clients[client]
+	c.inUse--
+	p.inUse--
+	p.forget(client, c)
+	p.dispatch()
+	p.observe()
+}
+
+func (p *Pool) client(key string) *clientState {
+	c, ok := p.clients[key]
+	if !ok {
+		weight := 1
+		if w, ok := p.cfg.Weights[key]; ok && w > 0 {
+			weight = w
+		}
+		c = &clientState{weight: float64(weight), virtual: p.virtual}
+		p.clients[key] = c
+	}
+	return c
+}
+
+func (p *Pool) forget(key string, c *clientState) {
+	if c.inUse == 0 && len(c.queue) == 0 {
+		delete(p.clients, key)
+	}
+}
+
+// dispatch раздает свободные слоты, вызывается под mu
+func (p *Pool) dispatch() {
+	for p.inUse < p.cfg.Slots {
+		var next *clientState
+		for _, c := range p.clients {
+			if len(c.queue) == 0 || (p.cfg.PerClient > 0 && c.inUse >= p.cfg.PerClient) {
+				continue
+			}
+			if next == nil || c.virtual < next.virtual {
+				next = c
+			}
+		}
+		if next == nil {
+			return
+		}
+
+		w := next.queue[0]
+		next.queue = next.queue[1:]
+		next.inUse++
+		if next.virtual < p.virtual {
+			next.virtual = p.virtual
+		}
+		p.virtual = next.virtual
+		next.virtual += 1 / next.weight
+
+		p.inUse++
+		p.waiting--
+		w.granted = true
+		close(w.ready)
+	}
+}
+
+// Waiting - сколько вызовов сейчас в очереди
+func (p *Pool) Waiting() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.waiting
+}
+
+func (p *Pool) observe() {
+	metrics.AdmissionQueueDepth.WithLabelValues(p.name).Set(float64(p.waiting))
+	metrics.AdmissionInUse.WithLabelValues(p.name).Set(float64(p.inUse))
+}
+
+// Controller - раздельные пулы для загрузки и скачивания
+type Controller struct {
+	Uploads   *Pool
+	Downloads *Pool
+}
+
+func New(uploads, downloads Config) *Controller {
+	return &Controller{
+		Uploads:   NewPool("upload", uploads),
+		Downloads: NewPool("download", downloads),
+	}
+}
@@ -0,0 +1,64 @@
+package admission
+
+import (
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/viper"
+)
+
+const (
+	defaultSlots        = 10
+	defaultQueueTimeout = 30 * time.Second
+)
+
+type weightConfig struct {
+	Client string `mapstructure:"client"`
+	Weight int    `mapstructure:"weight"`
+}
+
+// LoadConfig читает настройки пулов:
+//
+//	admission:
+//	  upload_slots: 10
+//	  download_slots: 10
+//	  per_client: 4
+//	  queue_timeout_ms: 30000
+//	  client_weights:
+//	    - client: id:dashboard
+//	      weight: 4
+func LoadConfig(v *viper.Viper) (uploads, downloads Config, err error) {
+	var weights []weightConfig
+	if err := v.UnmarshalKey("admission.client_weights", &weights); err != nil {
+		return Config{}, Config{}, errors.Wrap(err, "cant parse admission.client_weights")
+	}
+
+	byClient := make(map[string]int, len(weights))
+	for _, w := range weights {
+		if w.Client == "" || w.Weight <= 0 {
+			return Config{}, Config{}, errors.Errorf("invalid admission weight for %q", w.Client)
+		}
+		byClient[w.Client] = w.Weight
+	}
+
+	base := Config{
+		PerClient:    v.GetInt("admission.per_client"),
+		QueueTimeout: time.Duration(v.GetInt("admission.queue_timeout_ms")) * time.Millisecond,
+		Weights:      byClient,
+	}
+
+	if base.QueueTimeout <= 0 {
+		base.QueueTimeout = defaultQueueTimeout
+	}
+
+	uploads, downloads = base, base
+	uploads.Slots = v.GetInt("admission.upload_slots")
+	downloads.Slots = v.GetInt("admission.download_slots")
+	if uploads.Slots <= 0 {
+		uploads.Slots = defaultSlots
+	}
+	if downloads.Slots <= 0 {
+		downloads.Slots = defaultSlots
+	}
+	return uploads, downloads, nil
+}
@@ -0,0 +1,162 @@
+package audit
+
+import (
+	"Tages/internal/dto"
+	"Tages/internal/metrics"
+	"context"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Store - хранилище журнала аудита
+type Store interface {
+	AddAuditEvents(ctx context.Context, events []dto.AuditEvent) error
+	QueryAuditEvents(ctx context.Context, filter dto.AuditFilter) ([]dto.AuditEvent, error)
+}
+
+type Config struct {
+	// прокси, от которых принимаем x-client-id как личность клиента
+	TrustedProxies []*net.IPNet
+	QueueSize      int
+	BatchSize      int
+	FlushInterval  time.Duration
+	EnqueueTimeout time.Duration
+	WriteTimeout   time.Duration
+}
+
+// Auditor пишет события аудита в хранилище асинхронно, пачками
+type Auditor struct {
+	store  Store
+	logger *logrus.Logger
+	cfg    Config
+
+	queue    chan dto.AuditEvent
+	closed   bool
+	closedMu sync.RWMutex
+	done     chan struct{}
+}
+
+func New(store Store, logger *logrus.Logger, cfg Config) *Auditor {
+	if cfg.QueueSize <= 0 {
+		cfg.QueueSize = 1024
+	}
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = 100
+	}
+	if cfg.FlushInterval <= 0 {
+		cfg.FlushInterval = time.Second
+	}
+	if cfg.WriteTimeout <= 0 {
+		cfg.WriteTimeout = 10 * time.Second
+	}
+
+	return &Auditor{
+		store:  store,
+		logger: logger,
+		cfg:    cfg,
+		queue:  make(chan dto.AuditEvent, cfg.QueueSize),
+		done:   make(chan struct{}),
+	}
+}
+
+// Record ставит событие в очередь. Если очередь заполнена, вызывающий ждет
+// освобождения места не дольше EnqueueTimeout, после чего событие отбрасывается.
+func (a *Auditor) Record(ctx context.Context, ev dto.AuditEvent) bool {
+	a.closedMu.RLock()
+	defer a.closedMu.RUnlock()
+
+	if a.closed {
+		metrics.AuditEventsTotal.WithLabelValues("dropped").Inc()
+		return false
+	}
+
+	select {
+	case a.queue <- ev:
+		metrics.AuditQueueDepth.Set(float64(len(a.queue)))
+		return true
+	default:
+	}
+
+	a.logger.WithField("queue_size", cap(a.queue)).Warn("Audit queue is full, applying back-pressure")
+
+	var timeout <-chan time.Time
+	if a.cfg.EnqueueTimeout > 0 {
+		timer := time.NewTimer(a.cfg.EnqueueTimeout)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+
+	select {
+	case a.queue <- ev:
+		metrics.AuditQueueDepth.Set(float64(len(a.queue)))
+		return true
+	case <-ctx.Done():
+	case <-timeout:
+	}
+
+	metrics.AuditEventsTotal.WithLabelValues("dropped").Inc()
+	a.logger.WithFields(logrus.Fields{
+		"actor":  ev.Actor,
+		"method": ev.Method,
+	}).Error("Audit event dropped")
+	return false
+}
+
+// Run пишет события из очереди, пока она не будет закрыта через Close
+func (a *Auditor) Run() {
+	defer close(a.done)
+
+	ticker := time.NewTicker(a.cfg.FlushInterval)
+	defer ticker.Stop()
+
+	batch := make([]dto.AuditEvent, 0, a.cfg.BatchSize)
+	for {
+		select {
+		case ev, ok := <-a.queue:
+			if !ok {
+				a.flush(batch)
+				return
+			}
+			batch = append(batch, ev)
+			if len(batch) >= a.cfg.BatchSize {
+				a.flush(batch)
+				batch = batch[:0]
+			}
+		case <-ticker.C:
+			a.flush(batch)
+			batch = batch[:0]
+		}
+		metrics.AuditQueueDepth.Set(float64(len(a.queue)))
+	}
+}
+
+func (a *Auditor) flush(batch []dto.AuditEvent) {
+	if len(batch) == 0 {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), a.cfg.WriteTimeout)
+	defer cancel()
+
+	if err := a.store.AddAuditEvents(ctx, batch); err != nil {
+		metrics.AuditEventsTotal.WithLabelValues("failed").Add(float64(len(batch)))
+		a.logger.WithError(err).WithField("events", len(batch)).Error("Failed to write audit events")
+		return
+	}
+	metrics.AuditEventsTotal.WithLabelValues("written").Add(float64(len(batch)))
+}
+
+// Close закрывает очередь и ждет, пока Run допишет оставшиеся события
+func (a *Auditor) Close() {
+	a.closedMu.Lock()
+	if !a.closed {
+		a.closed = true
+		close(a.queue)
+	}
+	a.closedMu.Unlock()
+
+	<-a.done
+}
@@ -0,0 +1,39 @@
+package audit
+
+import (
+	"Tages/internal/dto"
+	"context"
+	"encoding/json"
+	"io"
+
+	"github.com/pkg/errors"
+)
+
+const exportPageSize = 1000
+
+// ExportJSONL выгружает события под фильтр в w, по одному JSON-объекту на строку.
+// Возвращает количество выгруженных событий.
+func ExportJSONL(ctx context.Context, store Store, filter dto.AuditFilter, w io.Writer) (int, error) {
+	enc := json.NewEncoder(w)
+	filter.Limit = exportPageSize
+
+	total := 0
+	for {
+		events, err := store.QueryAuditEvents(ctx, filter)
+		if err != nil {
+			return total, errors.Wrap(err, "failed to query audit events")
+		}
+
+		for _, ev := range events {
+			if err := enc.Encode(ev); err != nil {
+				return total, errors.Wrap(err, "failed to write audit event")
+			}
+			total++
+		}
+
+		if len(events) < exportPageSize {
+			return total, nil
+		}
+		filter.AfterID = events[len(events)-1].ID
+	}
+}
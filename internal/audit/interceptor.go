@@ -0,0 +1,101 @@
+package audit
+
+import (
+	"Tages/internal/clientinfo"
+	"Tages/internal/dto"
+	"context"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+)
+
+type entryKey struct{}
+
+// entry - данные о файле, которые заполняет обработчик
+type entry struct {
+	mu       sync.Mutex
+	fileName string
+	bytes    int64
+}
+
+// Annotate дописывает в событие аудита текущего вызова имя файла и объем данных
+func Annotate(ctx context.Context, fileName string, bytes int64) {
+	e, ok := ctx.Value(entryKey{}).(*entry)
+	if !ok {
+		return
+	}
+	e.mu.Lock()
+	if fileName != "" {
+		e.fileName = fileName
+	}
+	e.bytes += bytes
+	e.mu.Unlock()
+}
+
+type auditStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *auditStream) Context() context.Context {
+	return s.ctx
+}
+
+func (a *Auditor) UnaryInterceptor() grpc.UnaryServerInterceptor {
+	return func(
+		ctx context.Context,
+		req interface{},
+		info *grpc.UnaryServerInfo,
+		handler grpc.UnaryHandler,
+	) (interface{}, error) {
+		start := time.Now()
+		e := &entry{}
+
+		resp, err := handler(context.WithValue(ctx, entryKey{}, e), req)
+
+		a.record(ctx, info.FullMethod, e, err, start)
+		return resp, err
+	}
+}
+
+func (a *Auditor) StreamInterceptor() grpc.StreamServerInterceptor {
+	return func(
+		srv interface{},
+		ss grpc.ServerStream,
+		info *grpc.StreamServerInfo,
+		handler grpc.StreamHandler,
+	) error {
+		start := time.Now()
+		e := &entry{}
+		ctx := ss.Context()
+
+		err := handler(srv, &auditStream{
+			ServerStream: ss,
+			ctx:          context.WithValue(ctx, entryKey{}, e),
+		})
+
+		a.record(ctx, info.FullMethod, e, err, start)
+		return err
+	}
+}
+
+func (a *Auditor) record(ctx context.Context, method string, e *entry, err error, start time.Time) {
+	e.mu.Lock()
+	fileName, bytes := e.fileName, e.bytes
+	e.mu.Unlock()
+
+	// отмена запроса клиентом не должна терять событие
+	a.Record(context.WithoutCancel(ctx), dto.AuditEvent{
+		OccurredAt: start.UTC(),
+		// только проверенная личность, заголовок подставить может кто угодно
+		Actor:         clientinfo.AuthenticatedActor(ctx, a.cfg.TrustedProxies),
+		Peer:          clientinfo.Peer(ctx),
+		Method:        method,
+		FileName:      fileName,
+		Bytes:         bytes,
+		Code:          status.Code(err).String(),
+		LatencyMicros: time.Since(start).Microseconds(),
+	})
+}
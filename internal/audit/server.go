@@ -0,0 +1,103 @@
+package audit
+
+import (
+	"Tages/internal/admin"
+	"Tages/internal/dto"
+	pb "Tages/pkg"
+	"context"
+	"crypto/subtle"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+const defaultQueryLimit = 100
+
+// Server отдает журнал аудита только с админским токеном, без токена RPC выключен
+type Server struct {
+	pb.UnimplementedAuditServiceServer
+	store  Store
+	logger *logrus.Logger
+	token  string
+}
+
+func NewServer(store Store, logger *logrus.Logger, token string) *Server {
+	return &Server{
+		store:  store,
+		logger: logger,
+		token:  token,
+	}
+}
+
+// authorize проверяет токен из x-admin-token или authorization: Bearer
+func (s *Server) authorize(ctx context.Context) error {
+	if s.token == "" {
+		return status.Error(codes.PermissionDenied, "audit log query is disabled")
+	}
+
+	var token string
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if v := md.Get(admin.TokenHeader); len(v) > 0 {
+			token = v[0]
+		} else if v := md.Get("authorization"); len(v) > 0 {
+			token = strings.TrimPrefix(v[0], "Bearer ")
+		}
+	}
+	if subtle.ConstantTimeCompare([]byte(token), []byte(s.token)) != 1 {
+		return status.Error(codes.Unauthenticated, "invalid admin token")
+	}
+	return nil
+}
+
+func (s *Server) QueryAuditLog(ctx context.Context, req *pb.AuditQueryRequest) (*pb.AuditQueryResponse, error) {
+	if err := s.authorize(ctx); err != nil {
+		return nil, err
+	}
+
+	filter := dto.AuditFilter{
+		Actor:    req.GetActor(),
+		FileName: req.GetFileName(),
+		AfterID:  req.GetAfterId(),
+		Limit:    int(req.GetLimit()),
+	}
+	if req.From != nil {
+		filter.From = req.From.AsTime()
+	}
+	if req.To != nil {
+		filter.To = req.To.AsTime()
+	}
+	if !filter.From.IsZero() && !filter.To.IsZero() && !filter.From.Before(filter.To) {
+		return nil, status.Error(codes.InvalidArgument, "from must be before to")
+	}
+	if filter.Limit <= 0 {
+		filter.Limit = defaultQueryLimit
+	}
+
+	events, err := s.store.QueryAuditEvents(ctx, filter)
+	if err != nil {
+		s.logger.WithError(err).Error("failed to query audit log")
+		return nil, status.Error(codes.Internal, "failed to query audit log")
+	}
+
+	resp := &pb.AuditQueryResponse{NextAfterId: req.GetAfterId()}
+	for _, ev := range events {
+		resp.Events = append(resp.Events, &pb.AuditEvent{
+			Id:         ev.ID,
+			OccurredAt: timestamppb.New(ev.OccurredAt),
+			Actor:      ev.Actor,
+			Peer:       ev.Peer,
+			Method:     ev.Method,
+			FileName:   ev.FileName,
+			Bytes:      ev.Bytes,
+			Code:       ev.Code,
+			LatencyUs:  ev.LatencyMicros,
+		})
+		resp.NextAfterId = ev.ID
+	}
+
+	return resp, nil
+}
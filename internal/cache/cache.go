@@ -2,82 +2,382 @@ package cache
 
 import (
 	"Tages/internal/dto"
+	"Tages/internal/metrics"
+	"container/list"
+	"strings"
 	"sync"
+	"time"
 
 	"github.com/sirupsen/logrus"
 )
 
+// CacheInterface - кеш метаданных файлов, реализации: Cache в памяти и RedisCache
 type CacheInterface interface {
 	Set(f dto.File)
+	Get(name string) (dto.File, bool)
+	Delete(name string)
+	// Invalidate сбрасывает все записи, следующий список берется из БД
+	Invalidate()
+	// List отдает файлы по фильтру, ok = false - кеш неполный и нужен запрос в БД
+	List(filter Filter) ([]dto.File, bool)
 	GetFilesFromCache() []dto.File
 	Warm(files []dto.File)
 }
 
+// Tunable - кеш с настройками cache.enabled и cache.* лимитов, которые
+// меняются без перезапуска; реализуют Cache и RedisCache
+type Tunable interface {
+	CacheInterface
+	SetEnabled(enabled bool)
+	SetLimits(limits Limits)
+}
+
+// Filter - отбор файлов в List, пустой фильтр - все файлы
+type Filter struct {
+	Prefix string
+	// 0 - без ограничения
+	Limit int
+}
+
+func (f Filter) match(file dto.File) bool {
+	return strings.HasPrefix(file.Name, f.Prefix)
+}
+
+// apply отбирает файлы по фильтру, исходный срез не меняется
+func (f Filter) apply(files []dto.File) []dto.File {
+	if f.Prefix == "" && f.Limit <= 0 {
+		return files
+	}
+
+	out := make([]dto.File, 0, len(files))
+	for _, file := range files {
+		if f.Limit > 0 && len(out) == f.Limit {
+			break
+		}
+		if f.match(file) {
+			out = append(out, file)
+		}
+	}
+	return out
+}
+
+// Limits - границы кеша, нулевое значение поля - без ограничения
+type Limits struct {
+	MaxEntries int
+	MaxBytes   int64
+	TTL        time.Duration
+}
+
+var DefaultLimits = Limits{
+	MaxEntries: 10000,
+	MaxBytes:   16 * 1024 * 1024,
+}
+
+// примерные накладные расходы на запись: uuid, даты, элемент списка и map
+const entryOverhead = 160
+
+type entry struct {
+	file      dto.File
+	size      int64
+	expiresAt time.Time
+}
+
+// Cache - LRU метаданных файлов. Список файлов отдается из кеша, только пока
+// он полный: после прогрева ничего не вытеснено и не истекло. Иначе
+// List возвращает ok = false и список берется из БД.
 type Cache struct {
-	data          map[string]dto.File
+	data          map[string]*list.Element
+	lru           *list.List
+	bytes         int64
+	limits        Limits
+	complete      bool
 	rm            sync.RWMutex
 	logger        *logrus.Logger
-	cacheDetector chan bool
-	enabled       bool
+	cacheDetector chan float64
+	// enabled - включен ли кеш в конфиге, state - состояние под давлением памяти
+	enabled    bool
+	state      State
+	pressure   PressureConfig
+	belowSince time.Time
+	rewarm     func()
+	// лимиты в StateDegraded, доля размера кеша на момент перехода
+	degraded Limits
 }
 
-func NewCache(logger *logrus.Logger, cacheDetector chan bool) *Cache {
+// NewCache создает кеш, cacheDetector получает процент занятой памяти
+func NewCache(logger *logrus.Logger, cacheDetector chan float64) *Cache {
 	return &Cache{
-		data:          make(map[string]dto.File),
+		data:          make(map[string]*list.Element),
+		lru:           list.New(),
+		limits:        DefaultLimits,
 		logger:        logger,
 		cacheDetector: cacheDetector,
 		enabled:       true,
+		pressure:      DefaultPressureConfig,
 	}
 }
-func (c *Cache) RunWatcher() {
-	go func() {
-		for state := range c.cacheDetector {
-			c.rm.Lock()
-			c.enabled = false
-			c.rm.Unlock()
-			if !state {
-				c.logger.Warn("Cache disabled due to high CPU load")
-				return
-			}
-		}
-	}()
+
+// SetEnabled включает или выключает кеш вручную, из конфига
+func (c *Cache) SetEnabled(enabled bool) {
+	c.rm.Lock()
+	c.enabled = enabled
+	if !enabled {
+		c.reset()
+	}
+	c.rm.Unlock()
+}
+
+// SetLimits меняет границы кеша, лишние записи вытесняются сразу
+func (c *Cache) SetLimits(limits Limits) {
+	c.rm.Lock()
+	c.limits = limits
+	c.evict()
+	c.rm.Unlock()
 }
 
 func (c *Cache) Set(f dto.File) {
-	c.rm.RLock()
-	enabled := c.enabled
-	c.rm.RUnlock()
+	c.rm.Lock()
+	defer c.rm.Unlock()
 
-	if !enabled {
+	if !c.usable() {
 		c.logger.Debug("Skipping cache write (disabled)")
 		return
 	}
 
+	c.put(f)
+	c.evict()
+}
+
+// Get ищет метаданные файла по имени
+func (c *Cache) Get(name string) (dto.File, bool) {
+	c.rm.Lock()
+	defer c.rm.Unlock()
+
+	if !c.usable() {
+		return dto.File{}, false
+	}
+
+	el, ok := c.data[name]
+	if !ok {
+		metrics.CacheRequests.WithLabelValues("get", "miss").Inc()
+		return dto.File{}, false
+	}
+
+	e := el.Value.(*entry)
+	if c.expired(e, time.Now()) {
+		c.remove(el, "ttl")
+		metrics.CacheRequests.WithLabelValues("get", "miss").Inc()
+		return dto.File{}, false
+	}
+
+	c.lru.MoveToFront(el)
+	metrics.CacheRequests.WithLabelValues("get", "hit").Inc()
+	return e.file, true
+}
+
+// Delete убирает удаленный файл, полнота списка при этом сохраняется
+func (c *Cache) Delete(name string) {
+	c.rm.Lock()
+	defer c.rm.Unlock()
+
+	el, ok := c.data[name]
+	if !ok {
+		return
+	}
+	e := el.Value.(*entry)
+	c.lru.Remove(el)
+	delete(c.data, name)
+	c.bytes -= e.size
+	c.observe()
+}
+
+// Invalidate очищает кеш, он снова заполнится при следующем ListFiles
+func (c *Cache) Invalidate() {
 	c.rm.Lock()
-	c.data[f.Name] = f
+	c.reset()
 	c.rm.Unlock()
 }
 
 func (c *Cache) GetFilesFromCache() []dto.File {
-	if !c.enabled {
-		return nil
+	files, _ := c.List(Filter{})
+	return files
+}
+
+func (c *Cache) List(filter Filter) ([]dto.File, bool) {
+	c.rm.Lock()
+	defer c.rm.Unlock()
+
+	if !c.usable() {
+		return nil, false
 	}
-	c.rm.RLock()
-	defer c.rm.RUnlock()
 
-	files := make([]dto.File, 0, len(c.data))
+	now := time.Now()
+	for el := c.lru.Back(); el != nil; {
+		prev := el.Prev()
+		if c.expired(el.Value.(*entry), now) {
+			c.remove(el, "ttl")
+		}
+		el = prev
+	}
 
-	for _, v := range c.data {
-		files = append(files, v)
+	if !c.complete {
+		metrics.CacheRequests.WithLabelValues("list", "miss").Inc()
+		return nil, false
 	}
 
-	return files
+	files := make([]dto.File, 0, len(c.data))
+	for el := c.lru.Front(); el != nil; el = el.Next() {
+		if filter.Limit > 0 && len(files) == filter.Limit {
+			break
+		}
+		if f := el.Value.(*entry).file; filter.match(f) {
+			files = append(files, f)
+		}
+	}
+
+	metrics.CacheRequests.WithLabelValues("list", "hit").Inc()
+	return files, true
 }
 
+// Warm заполняет кеш полным списком файлов из БД. Список, который не
+// помещается в границы, не кладется вовсе: он все равно стал бы неполным
+// после вытеснения, а вытеснение выбросило бы горячие записи для Get.
 func (c *Cache) Warm(files []dto.File) {
 	c.rm.Lock()
+	defer c.rm.Unlock()
+
+	if !c.usable() {
+		return
+	}
+	if !c.fits(files) {
+		c.logger.WithField("files", len(files)).Debug("File list exceeds cache limits, not caching it")
+		return
+	}
+
+	c.complete = true
 	for _, v := range files {
-		c.data[v.Name] = v
+		c.put(v)
+	}
+	c.evict()
+}
+
+// fits - помещается ли полный список в текущие границы
+func (c *Cache) fits(files []dto.File) bool {
+	limits := c.effectiveLimits()
+	if limits.MaxEntries > 0 && len(files) > limits.MaxEntries {
+		return false
+	}
+	if limits.MaxBytes > 0 {
+		var size int64
+		for _, f := range files {
+			size += entrySize(f)
+		}
+		if size > limits.MaxBytes {
+			return false
+		}
+	}
+	return true
+}
+
+func entrySize(f dto.File) int64 {
+	return int64(len(f.Name)+len(f.Path)) + entryOverhead
+}
+
+func (c *Cache) put(f dto.File) {
+	e := &entry{
+		file: f,
+		size: entrySize(f),
+	}
+	if c.limits.TTL > 0 {
+		e.expiresAt = time.Now().Add(c.limits.TTL)
+	}
+
+	if el, ok := c.data[f.Name]; ok {
+		c.bytes -= el.Value.(*entry).size
+		el.Value = e
+		c.lru.MoveToFront(el)
+	} else {
+		c.data[f.Name] = c.lru.PushFront(e)
+	}
+	c.bytes += e.size
+	c.observe()
+}
+
+// evict вытесняет самые давние записи, пока кеш не уложится в границы
+func (c *Cache) evict() {
+	for c.lru.Len() > 0 && c.overLimit() {
+		reason := "size"
+		if c.state == StateDegraded {
+			reason = "pressure"
+		}
+		c.remove(c.lru.Back(), reason)
+	}
+}
+
+func (c *Cache) overLimit() bool {
+	limits := c.effectiveLimits()
+	return (limits.MaxEntries > 0 && c.lru.Len() > limits.MaxEntries) ||
+		(limits.MaxBytes > 0 && c.bytes > limits.MaxBytes)
+}
+
+func (c *Cache) usable() bool {
+	return c.enabled && c.state != StateDisabled
+}
+
+func (c *Cache) remove(el *list.Element, reason string) {
+	e := el.Value.(*entry)
+	c.lru.Remove(el)
+	delete(c.data, e.file.Name)
+	c.bytes -= e.size
+	// без этой записи список файлов в кеше уже неполный
+	c.complete = false
+
+	metrics.CacheEvictions.WithLabelValues(reason).Inc()
+	c.observe()
+}
+
+func (c *Cache) reset() {
+	c.data = make(map[string]*list.Element)
+	c.lru.Init()
+	c.bytes = 0
+	c.complete = false
+	c.observe()
+}
+
+func (c *Cache) expired(e *entry, now time.Time) bool {
+	return !e.expiresAt.IsZero() && now.After(e.expiresAt)
+}
+
+func (c *Cache) observe() {
+	metrics.CacheEntries.Set(float64(c.lru.Len()))
+	metrics.CacheBytes.Set(float64(c.bytes))
+}
+
+// Stats - снимок состояния кеша для отладочных ручек
+type Stats struct {
+	Enabled    bool   `json:"enabled"`
+	State      string `json:"state"`
+	Complete   bool   `json:"complete"`
+	Entries    int    `json:"entries"`
+	Bytes      int64  `json:"bytes"`
+	MaxEntries int    `json:"max_entries"`
+	MaxBytes   int64  `json:"max_bytes"`
+	TTL        string `json:"ttl"`
+}
+
+func (c *Cache) Stats() Stats {
+	c.rm.RLock()
+	defer c.rm.RUnlock()
+
+	limits := c.effectiveLimits()
+	return Stats{
+		Enabled:    c.enabled,
+		State:      c.state.String(),
+		Complete:   c.complete,
+		Entries:    c.lru.Len(),
+		Bytes:      c.bytes,
+		MaxEntries: limits.MaxEntries,
+		MaxBytes:   limits.MaxBytes,
+		TTL:        limits.TTL.String(),
 	}
-	c.rm.Unlock()
 }
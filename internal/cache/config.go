@@ -0,0 +1,131 @@
+package cache
+
+import (
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/viper"
+)
+
+// LoadLimits читает границы кеша:
+//
+//	cache:
+//	  max_entries: 10000
+//	  max_bytes: 16777216
+//	  ttl_ms: 0
+func LoadLimits(v *viper.Viper) (Limits, error) {
+	limits := Limits{
+		MaxEntries: v.GetInt("cache.max_entries"),
+		MaxBytes:   v.GetInt64("cache.max_bytes"),
+		TTL:        time.Duration(v.GetInt64("cache.ttl_ms")) * time.Millisecond,
+	}
+
+	if limits.MaxEntries < 0 || limits.MaxBytes < 0 || limits.TTL < 0 {
+		return Limits{}, errors.New("cache limits must not be negative")
+	}
+
+	return limits, nil
+}
+
+// memoryOnly - настройки, которые есть только у кеша в памяти
+var memoryOnly = []string{"cache.max_bytes", "cache.ttl_ms", "cache.pressure"}
+
+// CheckRedisSettings отклоняет настройки, которых у RedisCache нет: объем
+// записей считается только в памяти процесса, время жизни задает
+// cache.redis.ttl_ms, а давление памяти процесса к redis отношения не имеет
+func CheckRedisSettings(v *viper.Viper) error {
+	for _, key := range memoryOnly {
+		if v.InConfig(key) {
+			return errors.Errorf("%s is not supported with cache.backend redis", key)
+		}
+	}
+	return nil
+}
+
+// LoadPressureConfig читает пороги памяти для кеша:
+//
+//	cache:
+//	  pressure:
+//	    high_percent: 70
+//	    critical_percent: 85
+//	    recovery_percent: 60
+//	    cooldown_ms: 120000
+//	    degraded_ratio: 0.5
+//	    sample_interval_ms: 15000
+func LoadPressureConfig(v *viper.Viper) (PressureConfig, error) {
+	cfg := PressureConfig{
+		HighPercent:     v.GetFloat64("cache.pressure.high_percent"),
+		CriticalPercent: v.GetFloat64("cache.pressure.critical_percent"),
+		RecoveryPercent: v.GetFloat64("cache.pressure.recovery_percent"),
+		Cooldown:        time.Duration(v.GetInt64("cache.pressure.cooldown_ms")) * time.Millisecond,
+		DegradedRatio:   v.GetFloat64("cache.pressure.degraded_ratio"),
+		SampleInterval:  time.Duration(v.GetInt64("cache.pressure.sample_interval_ms")) * time.Millisecond,
+	}
+
+	if cfg.RecoveryPercent > cfg.HighPercent || cfg.HighPercent > cfg.CriticalPercent {
+		return PressureConfig{}, errors.New("cache pressure thresholds must satisfy recovery <= high <= critical")
+	}
+	if cfg.DegradedRatio <= 0 || cfg.DegradedRatio > 1 {
+		return PressureConfig{}, errors.New("cache.pressure.degraded_ratio must be in (0, 1]")
+	}
+	if cfg.Cooldown < 0 {
+		return PressureConfig{}, errors.New("cache.pressure.cooldown_ms must not be negative")
+	}
+	if cfg.SampleInterval <= 0 {
+		return PressureConfig{}, errors.New("cache.pressure.sample_interval_ms must be positive")
+	}
+
+	return cfg, nil
+}
+
+// LoadContentLimits читает бюджет кеша содержимого:
+//
+//	cache:
+//	  content:
+//	    max_bytes: 67108864
+//	    max_file_size: 262144
+func LoadContentLimits(v *viper.Viper) (ContentLimits, error) {
+	limits := ContentLimits{
+		MaxBytes:    v.GetInt64("cache.content.max_bytes"),
+		MaxFileSize: v.GetInt64("cache.content.max_file_size"),
+	}
+
+	if limits.MaxBytes < 0 || limits.MaxFileSize < 0 {
+		return ContentLimits{}, errors.New("cache.content limits must not be negative")
+	}
+
+	return limits, nil
+}
+
+// LoadRedisConfig читает настройки общего кеша в redis:
+//
+//	cache:
+//	  backend: redis
+//	  redis:
+//	    addr: localhost:6379
+//	    key_prefix: "tages:cache:"
+//	    timeout_ms: 50
+//	    ttl_ms: 3600000
+//	    breaker_failures: 5
+//	    breaker_cooldown_ms: 10000
+func LoadRedisConfig(v *viper.Viper) (RedisConfig, error) {
+	cfg := RedisConfig{
+		Addr:            v.GetString("cache.redis.addr"),
+		Password:        v.GetString("cache.redis.password"),
+		DB:              v.GetInt("cache.redis.db"),
+		KeyPrefix:       v.GetString("cache.redis.key_prefix"),
+		Timeout:         time.Duration(v.GetInt64("cache.redis.timeout_ms")) * time.Millisecond,
+		TTL:             time.Duration(v.GetInt64("cache.redis.ttl_ms")) * time.Millisecond,
+		BreakerFailures: v.GetInt("cache.redis.breaker_failures"),
+		BreakerCooldown: time.Duration(v.GetInt64("cache.redis.breaker_cooldown_ms")) * time.Millisecond,
+	}
+
+	if cfg.Addr == "" {
+		return RedisConfig{}, errors.New("cache.redis.addr is required")
+	}
+	if cfg.TTL < 0 {
+		return RedisConfig{}, errors.New("cache.redis.ttl_ms must not be negative")
+	}
+
+	return cfg, nil
+}
@@ -0,0 +1,193 @@
+package cache
+
+import (
+	"Tages/internal/metrics"
+	"container/list"
+	"sync"
+
+	"github.com/google/uuid"
+)
+
+// ContentLimits - бюджет кеша содержимого, MaxBytes = 0 выключает кеш
+type ContentLimits struct {
+	MaxBytes int64
+	// файлы больше этого размера не кешируются
+	MaxFileSize int64
+}
+
+var DefaultContentLimits = ContentLimits{
+	MaxBytes:    64 * 1024 * 1024,
+	MaxFileSize: 256 * 1024,
+}
+
+type contentKey struct {
+	id       uuid.UUID
+	checksum string
+}
+
+type contentEntry struct {
+	key  contentKey
+	data []byte
+}
+
+// ContentCache - LRU содержимого небольших файлов. Ключ включает контрольную
+// сумму, поэтому измененный файл никогда не отдается из старой записи.
+type ContentCache struct {
+	mu     sync.Mutex
+	limits ContentLimits
+	items  map[contentKey]*list.Element
+	byID   map[uuid.UUID][]contentKey
+	lru    *list.List
+	bytes  int64
+}
+
+func NewContentCache(limits ContentLimits) *ContentCache {
+	return &ContentCache{
+		limits: limits,
+		items:  make(map[contentKey]*list.Element),
+		byID:   make(map[uuid.UUID][]contentKey),
+		lru:    list.New(),
+	}
+}
+
+// SetLimits меняет бюджет, лишнее вытесняется сразу
+func (c *ContentCache) SetLimits(limits ContentLimits) {
+	c.mu.Lock()
+	c.limits = limits
+	c.evict()
+	c.mu.Unlock()
+}
+
+// Cacheable - поместится ли файл такого размера в кеш
+func (c *ContentCache) Cacheable(size int64) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.limits.MaxBytes > 0 && size <= c.limits.MaxFileSize && size <= c.limits.MaxBytes
+}
+
+// Enabled - false, если кеш выключен через MaxBytes = 0
+func (c *ContentCache) Enabled() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.limits.MaxBytes > 0
+}
+
+// Get возвращает содержимое файла, срез нельзя изменять
+func (c *ContentCache) Get(id uuid.UUID, checksum string) ([]byte, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	el, ok := c.items[contentKey{id: id, checksum: checksum}]
+	if !ok {
+		metrics.CacheContentRequests.WithLabelValues("miss").Inc()
+		return nil, false
+	}
+
+	c.lru.MoveToFront(el)
+	metrics.CacheContentRequests.WithLabelValues("hit").Inc()
+	return el.Value.(*contentEntry).data, true
+}
+
+func (c *ContentCache) Put(id uuid.UUID, checksum string, data []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	size := int64(len(data))
+	if c.limits.MaxBytes <= 0 || size > c.limits.MaxFileSize || size > c.limits.MaxBytes {
+		return
+	}
+
+	key := contentKey{id: id, checksum: checksum}
+	if _, ok := c.items[key]; ok {
+		return
+	}
+
+	// старые версии того же файла больше не нужны
+	c.invalidate(id)
+
+	c.items[key] = c.lru.PushFront(&contentEntry{key: key, data: data})
+	c.byID[id] = append(c.byID[id], key)
+	c.bytes += size
+	c.evict()
+	c.observe()
+}
+
+// Invalidate удаляет все версии файла, вызывается при любом изменении
+func (c *ContentCache) Invalidate(id uuid.UUID) {
+	c.mu.Lock()
+	c.invalidate(id)
+	c.observe()
+	c.mu.Unlock()
+}
+
+// Purge очищает кеш целиком
+func (c *ContentCache) Purge() {
+	c.mu.Lock()
+	c.items = make(map[contentKey]*list.Element)
+	c.byID = make(map[uuid.UUID][]contentKey)
+	c.lru.Init()
+	c.bytes = 0
+	c.observe()
+	c.mu.Unlock()
+}
+
+func (c *ContentCache) invalidate(id uuid.UUID) {
+	for _, key := range c.byID[id] {
+		if el, ok := c.items[key]; ok {
+			c.remove(el)
+		}
+	}
+	delete(c.byID, id)
+}
+
+func (c *ContentCache) evict() {
+	for c.lru.Len() > 0 && c.bytes > c.limits.MaxBytes {
+		c.remove(c.lru.Back())
+		metrics.CacheContentEvictions.Inc()
+	}
+	c.observe()
+}
+
+func (c *ContentCache) remove(el *list.Element) {
+	e := el.Value.(*contentEntry)
+	c.lru.Remove(el)
+	delete(c.items, e.key)
+	c.bytes -= int64(len(e.data))
+
+	keys := c.byID[e.key.id]
+	for i, k := range keys {
+		if k == e.key {
+			keys = append(keys[:i], keys[i+1:]...)
+			break
+		}
+	}
+	if len(keys) == 0 {
+		delete(c.byID, e.key.id)
+	} else {
+		c.byID[e.key.id] = keys
+	}
+}
+
+func (c *ContentCache) observe() {
+	metrics.CacheContentBytes.Set(float64(c.bytes))
+}
+
+// ContentStats - снимок состояния кеша содержимого
+type ContentStats struct {
+	Entries     int   `json:"entries"`
+	Bytes       int64 `json:"bytes"`
+	MaxBytes    int64 `json:"max_bytes"`
+	MaxFileSize int64 `json:"max_file_size"`
+}
+
+func (c *ContentCache) Stats() ContentStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return ContentStats{
+		Entries:     c.lru.Len(),
+		Bytes:       c.bytes,
+		MaxBytes:    c.limits.MaxBytes,
+		MaxFileSize: c.limits.MaxFileSize,
+	}
+}
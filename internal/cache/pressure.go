@@ -0,0 +1,154 @@
+package cache
+
+import (
+	"Tages/internal/metrics"
+	"time"
+)
+
+// State - состояние кеша под давлением памяти
+type State int
+
+const (
+	StateEnabled State = iota
+	// лимиты урезаны, лишние записи вытеснены
+	StateDegraded
+	// кеш очищен и не используется
+	StateDisabled
+)
+
+func (s State) String() string {
+	switch s {
+	case StateDegraded:
+		return "degraded"
+	case StateDisabled:
+		return "disabled"
+	default:
+		return "enabled"
+	}
+}
+
+// PressureConfig - пороги использования памяти в процентах
+type PressureConfig struct {
+	HighPercent     float64
+	CriticalPercent float64
+	// ниже этого порога кеш восстанавливается, но только спустя Cooldown
+	RecoveryPercent float64
+	Cooldown        time.Duration
+	// доля лимитов, которая остается в StateDegraded
+	DegradedRatio float64
+	// период замера памяти, меняется только перезапуском
+	SampleInterval time.Duration
+}
+
+var DefaultPressureConfig = PressureConfig{
+	HighPercent:     70,
+	CriticalPercent: 85,
+	RecoveryPercent: 60,
+	Cooldown:        2 * time.Minute,
+	DegradedRatio:   0.5,
+	SampleInterval:  15 * time.Second,
+}
+
+// SetPressureConfig меняет пороги, текущее состояние сохраняется
+func (c *Cache) SetPressureConfig(cfg PressureConfig) {
+	c.rm.Lock()
+	c.pressure = cfg
+	c.evict()
+	c.rm.Unlock()
+}
+
+// OnRecover задает прогрев, который вызывается после возврата в StateEnabled
+func (c *Cache) OnRecover(fn func()) {
+	c.rm.Lock()
+	c.rewarm = fn
+	c.rm.Unlock()
+}
+
+func (c *Cache) State() State {
+	c.rm.RLock()
+	defer c.rm.RUnlock()
+	return c.state
+}
+
+// RunWatcher применяет замеры памяти из metrics.WatchMemory
+func (c *Cache) RunWatcher() {
+	for percent := range c.cacheDetector {
+		c.Observe(percent)
+	}
+}
+
+// Observe переводит кеш между состояниями по проценту занятой памяти
+func (c *Cache) Observe(percent float64) {
+	c.rm.Lock()
+
+	now := time.Now()
+	next := c.state
+	switch {
+	case percent >= c.pressure.CriticalPercent:
+		next = StateDisabled
+	case percent >= c.pressure.HighPercent:
+		if c.state == StateEnabled {
+			next = StateDegraded
+		}
+	case percent < c.pressure.RecoveryPercent:
+		if c.belowSince.IsZero() {
+			c.belowSince = now
+		}
+		if now.Sub(c.belowSince) >= c.pressure.Cooldown {
+			next = StateEnabled
+		}
+	}
+	if percent >= c.pressure.RecoveryPercent {
+		c.belowSince = time.Time{}
+	}
+
+	if next == c.state {
+		c.rm.Unlock()
+		return
+	}
+
+	prev := c.state
+	c.state = next
+	switch next {
+	case StateDisabled:
+		c.reset()
+	case StateDegraded:
+		// урезаем кеш от текущего размера
+		c.degraded = Limits{
+			MaxEntries: max(1, int(float64(c.lru.Len())*c.pressure.DegradedRatio)),
+			MaxBytes:   max(1, int64(float64(c.bytes)*c.pressure.DegradedRatio)),
+		}
+		c.evict()
+	}
+	rewarm := c.rewarm
+	rewarmNeeded := next == StateEnabled && c.enabled && !c.complete
+	c.rm.Unlock()
+
+	c.logger.WithFields(map[string]interface{}{
+		"from":           prev.String(),
+		"to":             next.String(),
+		"memory_percent": percent,
+	}).Warn("Cache state changed")
+	metrics.CacheState.Set(float64(next))
+	metrics.CacheStateTransitions.WithLabelValues(prev.String(), next.String()).Inc()
+
+	if rewarmNeeded && rewarm != nil {
+		go rewarm()
+	}
+}
+
+// effectiveLimits - лимиты с учетом состояния
+func (c *Cache) effectiveLimits() Limits {
+	limits := c.limits
+	if c.state != StateDegraded {
+		return limits
+	}
+
+	if limits.MaxEntries == 0 || c.degraded.MaxEntries < limits.MaxEntries {
+		limits.MaxEntries = c.degraded.MaxEntries
+	}
+	if limits.MaxBytes == 0 || c.degraded.MaxBytes < limits.MaxBytes {
+		limits.MaxBytes = c.degraded.MaxBytes
+	}
+	return limits
+}
@@ -0,0 +1,405 @@
+package cache
+
+import (
+	"Tages/internal/dto"
+	"Tages/internal/metrics"
+	"context"
+	"encoding/json"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+	"github.com/redis/go-redis/v9"
+	"github.com/sirupsen/logrus"
+)
+
+// версия формата записи в redis, меняется при несовместимых изменениях
+const recordVersion = 1
+
+var (
+	errBreakerOpen    = errors.New("cache backend circuit is open")
+	errUnknownVersion = errors.New("unknown cache record version")
+)
+
+type RedisConfig struct {
+	Addr      string
+	Password  string
+	DB        int
+	KeyPrefix string
+	// таймаут одной операции
+	Timeout time.Duration
+	// время жизни общего кеша, продлевается при каждом прогреве
+	TTL time.Duration
+	// после стольких ошибок подряд кеш обходится до BreakerCooldown
+	BreakerFailures int
+	BreakerCooldown time.Duration
+}
+
+// RedisCache - общий для реплик кеш метаданных. Файлы лежат в одном hash,
+// отдельный ключ-маркер означает, что в hash полный список. Пока redis
+// недоступен, все вызовы уходят в БД.
+type RedisCache struct {
+	client      *redis.Client
+	logger      *logrus.Logger
+	filesKey    string
+	completeKey string
+	timeout     time.Duration
+	ttl         time.Duration
+	breaker     *breaker
+	// cache.enabled и cache.max_entries, меняются без перезапуска
+	enabled    atomic.Bool
+	maxEntries atomic.Int64
+}
+
+func NewRedisCache(cfg RedisConfig, logger *logrus.Logger) *RedisCache {
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = 50 * time.Millisecond
+	}
+	c := &RedisCache{
+		client: redis.NewClient(&redis.Options{
+			Addr:         cfg.Addr,
+			Password:     cfg.Password,
+			DB:           cfg.DB,
+			DialTimeout:  cfg.Timeout,
+			ReadTimeout:  cfg.Timeout,
+			WriteTimeout: cfg.Timeout,
+			MaxRetries:   -1,
+		}),
+		logger:      logger,
+		filesKey:    cfg.KeyPrefix + "files",
+		completeKey: cfg.KeyPrefix + "complete",
+		timeout:     cfg.Timeout,
+		ttl:         cfg.TTL,
+		breaker:     newBreaker(cfg.BreakerFailures, cfg.BreakerCooldown),
+	}
+	c.enabled.Store(true)
+	return c
+}
+
+// SetEnabled выключает чтение из кеша на этой реплике. Записи продолжают
+// уходить в redis, иначе общий список устарел бы для остальных реплик.
+func (c *RedisCache) SetEnabled(enabled bool) {
+	c.enabled.Store(enabled)
+}
+
+// SetLimits применяет MaxEntries: список больше лимита в redis не держим.
+// MaxBytes и TTL только у кеша в памяти, см. CheckRedisSettings.
+func (c *RedisCache) SetLimits(limits Limits) {
+	c.maxEntries.Store(int64(limits.MaxEntries))
+}
+
+func (c *RedisCache) Set(f dto.File) {
+	payload, err := encodeFile(f)
+	if err != nil {
+		c.logger.WithError(err).Warn("Cannot encode cache record")
+		return
+	}
+	_ = c.run("set", true, func(ctx context.Context) error {
+		size, err := c.client.HSet(ctx, c.filesKey, f.Name, payload).Result()
+		if err != nil {
+			return err
+		}
+		if size == 0 {
+			return nil
+		}
+		// новый файл мог вывести список за лимит
+		n, err := c.client.HLen(ctx, c.filesKey).Result()
+		if err != nil {
+			return err
+		}
+		if max := c.maxEntries.Load(); max > 0 && n > max {
+			return c.client.Del(ctx, c.completeKey, c.filesKey).Err()
+		}
+		return nil
+	})
+}
+
+func (c *RedisCache) Get(name string) (dto.File, bool) {
+	if !c.enabled.Load() {
+		metrics.CacheRequests.WithLabelValues("get", "miss").Inc()
+		return dto.File{}, false
+	}
+	var payload string
+	err := c.run("get", false, func(ctx context.Context) error {
+		var err error
+		payload, err = c.client.HGet(ctx, c.filesKey, name).Result()
+		return err
+	})
+	if err != nil {
+		metrics.CacheRequests.WithLabelValues("get", "miss").Inc()
+		return dto.File{}, false
+	}
+
+	f, err := decodeFile(payload)
+	if err != nil {
+		metrics.CacheRequests.WithLabelValues("get", "miss").Inc()
+		return dto.File{}, false
+	}
+	metrics.CacheRequests.WithLabelValues("get", "hit").Inc()
+	return f, true
+}
+
+func (c *RedisCache) Delete(name string) {
+	_ = c.run("delete", true, func(ctx context.Context) error {
+		return c.client.HDel(ctx, c.filesKey, name).Err()
+	})
+}
+
+func (c *RedisCache) Invalidate() {
+	_ = c.run("invalidate", true, func(ctx context.Context) error {
+		return c.client.Del(ctx, c.completeKey, c.filesKey).Err()
+	})
+}
+
+func (c *RedisCache) GetFilesFromCache() []dto.File {
+	files, _ := c.List(Filter{})
+	return files
+}
+
+func (c *RedisCache) List(filter Filter) ([]dto.File, bool) {
+	if !c.enabled.Load() {
+		metrics.CacheRequests.WithLabelValues("list", "miss").Inc()
+		return nil, false
+	}
+	var complete int64
+	var records map[string]string
+	err := c.run("list", false, func(ctx context.Context) error {
+		cmds, err := c.client.Pipelined(ctx, func(p redis.Pipeliner) error {
+			p.Exists(ctx, c.completeKey)
+			p.HGetAll(ctx, c.filesKey)
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		complete = cmds[0].(*redis.IntCmd).Val()
+		records = cmds[1].(*redis.MapStringStringCmd).Val()
+		return nil
+	})
+	if err != nil || complete == 0 {
+		metrics.CacheRequests.WithLabelValues("list", "miss").Inc()
+		return nil, false
+	}
+
+	files := make([]dto.File, 0, len(records))
+	for _, payload := range records {
+		f, err := decodeFile(payload)
+		if err != nil {
+			// запись другой версии, полный список отсюда не собрать
+			metrics.CacheRequests.WithLabelValues("list", "miss").Inc()
+			return nil, false
+		}
+		files = append(files, f)
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].Name < files[j].Name })
+
+	metrics.CacheRequests.WithLabelValues("list", "hit").Inc()
+	return filter.apply(files), true
+}
+
+// Warm дописывает полный список из БД и ставит маркер полноты
+func (c *RedisCache) Warm(files []dto.File) {
+	if !c.enabled.Load() {
+		return
+	}
+	if max := c.maxEntries.Load(); max > 0 && int64(len(files)) > max {
+		c.logger.WithFields(logrus.Fields{
+			"files":       len(files),
+			"max_entries": max,
+		}).Debug("File list exceeds cache.max_entries, not caching it")
+		return
+	}
+	values := make(map[string]interface{}, len(files))
+	for _, f := range files {
+		payload, err := encodeFile(f)
+		if err != nil {
+			c.logger.WithError(err).Warn("Cannot encode cache record")
+			return
+		}
+		values[f.Name] = payload
+	}
+
+	_ = c.run("warm", true, func(ctx context.Context) error {
+		_, err := c.client.TxPipelined(ctx, func(p redis.Pipeliner) error {
+			if len(values) > 0 {
+				p.HSet(ctx, c.filesKey, values)
+			}
+			p.Set(ctx, c.completeKey, 1, c.ttl)
+			if c.ttl > 0 {
+				p.Expire(ctx, c.filesKey, c.ttl)
+			}
+			return nil
+		})
+		return err
+	})
+}
+
+func (c *RedisCache) Close() error {
+	return c.client.Close()
+}
+
+// run выполняет операцию через предохранитель. Если запись не дошла до redis,
+// общий список больше нельзя считать полным: маркер снимается первой же
+// успешной операцией после восстановления.
+func (c *RedisCache) run(op string, write bool, fn func(ctx context.Context) error) error {
+	if !c.breaker.allow() {
+		if write {
+			c.breaker.markDirty()
+		}
+		metrics.CacheBackendErrors.WithLabelValues(op, "open").Inc()
+		return errBreakerOpen
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	defer cancel()
+
+	if c.breaker.isDirty() {
+		if err := c.client.Del(ctx, c.completeKey).Err(); err != nil {
+			c.fail(op, err)
+			return err
+		}
+		c.breaker.clearDirty()
+	}
+
+	err := fn(ctx)
+	if errors.Is(err, redis.Nil) {
+		c.breaker.success()
+		return err
+	}
+	if err != nil {
+		if write {
+			c.breaker.markDirty()
+		}
+		c.fail(op, err)
+		return err
+	}
+
+	c.breaker.success()
+	return nil
+}
+
+func (c *RedisCache) fail(op string, err error) {
+	metrics.CacheBackendErrors.WithLabelValues(op, "error").Inc()
+	if c.breaker.failure() {
+		c.logger.WithError(err).Warn("Redis cache unavailable, falling back to database")
+	}
+}
+
+// fileRecord - формат записи в redis, Path у dto.File не сериализуется в json
+type fileRecord struct {
+	V         int       `json:"v"`
+	ID        uuid.UUID `json:"id"`
+	Name      string    `json:"name"`
+	Path      string    `json:"path"`
+	Size      int64     `json:"size"`
+	Checksum  string    `json:"checksum"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+func encodeFile(f dto.File) (string, error) {
+	b, err := json.Marshal(fileRecord{
+		V:         recordVersion,
+		ID:        f.ID,
+		Name:      f.Name,
+		Path:      f.Path,
+		Size:      f.Size,
+		Checksum:  f.Checksum,
+		CreatedAt: f.CreatedAt,
+		UpdatedAt: f.UpdatedAt,
+	})
+	if err != nil {
+		return "", errors.Wrap(err, "cant encode cache record")
+	}
+	return string(b), nil
+}
+
+func decodeFile(payload string) (dto.File, error) {
+	var r fileRecord
+	if err := json.Unmarshal([]byte(payload), &r); err != nil {
+		return dto.File{}, errors.Wrap(err, "cant decode cache record")
+	}
+	if r.V != recordVersion {
+		return dto.File{}, errUnknownVersion
+	}
+	return dto.File{
+		ID:        r.ID,
+		Name:      r.Name,
+		Path:      r.Path,
+		Size:      r.Size,
+		Checksum:  r.Checksum,
+		CreatedAt: r.CreatedAt,
+		UpdatedAt: r.UpdatedAt,
+	}, nil
+}
+
+// breaker - простой предохранитель: после threshold ошибок подряд вызовы не
+// идут в redis cooldown, затем снова пробуют его. Ошибка после паузы сразу
+// размыкает предохранитель обратно.
+type breaker struct {
+	mu        sync.Mutex
+	threshold int
+	cooldown  time.Duration
+	failures  int
+	openUntil time.Time
+	dirty     bool
+}
+
+func newBreaker(threshold int, cooldown time.Duration) *breaker {
+	if threshold <= 0 {
+		threshold = 5
+	}
+	if cooldown <= 0 {
+		cooldown = 10 * time.Second
+	}
+	return &breaker{threshold: threshold, cooldown: cooldown}
+}
+
+func (b *breaker) allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return !time.Now().Before(b.openUntil)
+}
+
+func (b *breaker) success() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.failures >= b.threshold {
+		metrics.CacheBackendBreakerOpen.Set(0)
+	}
+	b.failures = 0
+}
+
+// failure возвращает true, если предохранитель только что разомкнулся
+func (b *breaker) failure() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.failures++
+	if b.failures < b.threshold {
+		return false
+	}
+	b.openUntil = time.Now().Add(b.cooldown)
+	metrics.CacheBackendBreakerOpen.Set(1)
+	return b.failures == b.threshold
+}
+
+func (b *breaker) markDirty() {
+	b.mu.Lock()
+	b.dirty = true
+	b.mu.Unlock()
+}
+
+func (b *breaker) isDirty() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.dirty
+}
+
+func (b *breaker) clearDirty() {
+	b.mu.Lock()
+	b.dirty = false
+	b.mu.Unlock()
+}
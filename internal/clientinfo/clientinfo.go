@@ -0,0 +1,40 @@
+package clientinfo
+
+import (
+	"context"
+
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+)
+
+const (
+	// ActorHeader - идентификатор клиента, который проставляет прокси, см. Identity
+	ActorHeader = "x-client-id"
+
+	Anonymous = "anonymous"
+	Unknown   = "unknown"
+)
+
+// Peer возвращает адрес клиента в виде host:port
+func Peer(ctx context.Context) string {
+	p, ok := peer.FromContext(ctx)
+	if !ok || p.Addr == nil {
+		return Unknown
+	}
+	return p.Addr.String()
+}
+
+func firstMetadata(ctx context.Context, key string) string {
+	if vals := allMetadata(ctx, key); len(vals) > 0 {
+		return vals[0]
+	}
+	return ""
+}
+
+func allMetadata(ctx context.Context, key string) []string {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return nil
+	}
+	return md.Get(key)
+}
@@ -0,0 +1,266 @@
+package clientinfo
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"net"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/viper"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/peer"
+)
+
+const (
+	ForwardedForHeader = "x-forwarded-for"
+	APIKeyHeader       = "x-api-key"
+)
+
+// KeyFunc возвращает ключ, по которому клиенты делят лимиты
+type KeyFunc func(ctx context.Context) string
+
+type KeyOptions struct {
+	// длина префикса для IPv6, по умолчанию /64
+	IPv6PrefixBits int
+	// прокси, которым доверяем x-forwarded-for и x-client-id
+	TrustedProxies []*net.IPNet
+	// выданные клиентам ключи для api_key, чужой ключ своего бакета не получает
+	APIKeys []string
+}
+
+// NewKeyFunc собирает KeyFunc по имени из конфига:
+// ip, ipv6_prefix, forwarded_for, identity, api_key
+func NewKeyFunc(kind string, opts KeyOptions) (KeyFunc, error) {
+	switch kind {
+	case "", "ip":
+		return HostKey, nil
+	case "ipv6_prefix":
+		return IPv6PrefixKey(opts.IPv6PrefixBits), nil
+	case "forwarded_for":
+		return ForwardedForKey(opts.TrustedProxies), nil
+	case "identity":
+		return IdentityKey(opts.TrustedProxies, HostKey), nil
+	case "api_key":
+		if len(opts.APIKeys) == 0 {
+			return nil, errors.New("api_key extractor needs ratelimiter.api_keys")
+		}
+		return APIKeyKey(opts.APIKeys, HostKey), nil
+	default:
+		return nil, errors.Errorf("unknown client key extractor %q", kind)
+	}
+}
+
+// FromConfig собирает KeyFunc из ratelimiter.key, ratelimiter.ipv6_prefix_bits,
+// ratelimiter.trusted_proxies и ratelimiter.api_keys, тот же ключ используют и другие лимиты
+func FromConfig(v *viper.Viper) (KeyFunc, error) {
+	trusted, err := TrustedProxiesFromConfig(v)
+	if err != nil {
+		return nil, err
+	}
+	return NewKeyFunc(v.GetString("ratelimiter.key"), KeyOptions{
+		IPv6PrefixBits: v.GetInt("ratelimiter.ipv6_prefix_bits"),
+		TrustedProxies: trusted,
+		APIKeys:        v.GetStringSlice("ratelimiter.api_keys"),
+	})
+}
+
+// TrustedProxiesFromConfig - ratelimiter.trusted_proxies, им же доверяем x-client-id
+func TrustedProxiesFromConfig(v *viper.Viper) ([]*net.IPNet, error) {
+	trusted, err := ParseCIDRs(v.GetStringSlice("ratelimiter.trusted_proxies"))
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid ratelimiter.trusted_proxies")
+	}
+	return trusted, nil
+}
+
+// ParseCIDRs разбирает список подсетей, одиночный адрес считается /32 или /128
+func ParseCIDRs(values []string) ([]*net.IPNet, error) {
+	nets := make([]*net.IPNet, 0, len(values))
+	for _, v := range values {
+		v = strings.TrimSpace(v)
+		if v == "" {
+			continue
+		}
+		if !strings.Contains(v, "/") {
+			ip := net.ParseIP(v)
+			if ip == nil {
+				return nil, errors.Errorf("invalid proxy address %q", v)
+			}
+			bits := 8 * net.IPv6len
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 8*net.IPv4len
+			}
+			nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, n, err := net.ParseCIDR(v)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid proxy network %q", v)
+		}
+		nets = append(nets, n)
+	}
+	return nets, nil
+}
+
+// HostKey - адрес клиента без порта, переподключение не дает новый ключ
+func HostKey(ctx context.Context) string {
+	ip := peerIP(ctx)
+	if ip == nil {
+		return peerHost(ctx)
+	}
+	return ip.String()
+}
+
+// IPv6PrefixKey объединяет IPv6-адреса одной подсети, IPv4 остается как есть
+func IPv6PrefixKey(bits int) KeyFunc {
+	if bits <= 0 || bits > 128 {
+		bits = 64
+	}
+	mask := net.CIDRMask(bits, 128)
+
+	return func(ctx context.Context) string {
+		ip := peerIP(ctx)
+		if ip == nil {
+			return peerHost(ctx)
+		}
+		if ip.To4() != nil {
+			return ip.String()
+		}
+		n := net.IPNet{IP: ip.Mask(mask), Mask: mask}
+		return n.String()
+	}
+}
+
+// ForwardedForKey берет адрес клиента из x-forwarded-for, но только если
+// соединение пришло от доверенного прокси. Список разбирается справа налево,
+// доверенные прокси пропускаются, первый недоверенный адрес и есть клиент.
+func ForwardedForKey(trusted []*net.IPNet) KeyFunc {
+	return func(ctx context.Context) string {
+		ip := peerIP(ctx)
+		if ip == nil || !contains(trusted, ip) {
+			return HostKey(ctx)
+		}
+
+		var hops []string
+		for _, v := range allMetadata(ctx, ForwardedForHeader) {
+			hops = append(hops, strings.Split(v, ",")...)
+		}
+
+		for i := len(hops) - 1; i >= 0; i-- {
+			hop := net.ParseIP(strings.TrimSpace(hops[i]))
+			if hop == nil {
+				break
+			}
+			if !contains(trusted, hop) {
+				return hop.String()
+			}
+		}
+		return ip.String()
+	}
+}
+
+// Identity - проверенная личность клиента: CN клиентского сертификата или
+// x-client-id, но только от доверенного прокси. Пусто, если клиент не
+// аутентифицирован: заголовок от остальных подделывается на каждый вызов.
+func Identity(ctx context.Context, trusted []*net.IPNet) string {
+	kind, name := identity(ctx, trusted)
+	if name == "" {
+		return ""
+	}
+	return kind + ":" + name
+}
+
+// AuthenticatedActor - имя из Identity без префикса, иначе Anonymous
+func AuthenticatedActor(ctx context.Context, trusted []*net.IPNet) string {
+	if _, name := identity(ctx, trusted); name != "" {
+		return name
+	}
+	return Anonymous
+}
+
+func identity(ctx context.Context, trusted []*net.IPNet) (kind, name string) {
+	if p, ok := peer.FromContext(ctx); ok {
+		if tlsInfo, ok := p.AuthInfo.(credentials.TLSInfo); ok && len(tlsInfo.State.VerifiedChains) > 0 {
+			if cn := tlsInfo.State.VerifiedChains[0][0].Subject.CommonName; cn != "" {
+				return "cn", cn
+			}
+		}
+	}
+	if ip := peerIP(ctx); ip != nil && contains(trusted, ip) {
+		if id := firstMetadata(ctx, ActorHeader); id != "" {
+			return "id", id
+		}
+	}
+	return "", ""
+}
+
+// IdentityKey - ключ по Identity, неаутентифицированные клиенты делят лимит по fallback
+func IdentityKey(trusted []*net.IPNet, fallback KeyFunc) KeyFunc {
+	return func(ctx context.Context) string {
+		if id := Identity(ctx, trusted); id != "" {
+			return id
+		}
+		return fallback(ctx)
+	}
+}
+
+// APIKeyKey - ключ по x-api-key из выданных keys, в памяти держим только хеши.
+// Незнакомый ключ идет в fallback, иначе каждый новый ключ давал бы новый бакет.
+func APIKeyKey(keys []string, fallback KeyFunc) KeyFunc {
+	known := make(map[string]struct{}, len(keys))
+	for _, k := range keys {
+		if k = strings.TrimSpace(k); k != "" {
+			known[hashKey(k)] = struct{}{}
+		}
+	}
+
+	return func(ctx context.Context) string {
+		key := firstMetadata(ctx, APIKeyHeader)
+		if key == "" {
+			return fallback(ctx)
+		}
+		h := hashKey(key)
+		if _, ok := known[h]; !ok {
+			return fallback(ctx)
+		}
+		return "key:" + h
+	}
+}
+
+func hashKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:8])
+}
+
+func peerHost(ctx context.Context) string {
+	addr := Peer(ctx)
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		return host
+	}
+	return addr
+}
+
+func peerIP(ctx context.Context) net.IP {
+	p, ok := peer.FromContext(ctx)
+	if !ok || p.Addr == nil {
+		return nil
+	}
+	switch a := p.Addr.(type) {
+	case *net.TCPAddr:
+		return a.IP
+	case *net.UDPAddr:
+		return a.IP
+	}
+	return net.ParseIP(peerHost(ctx))
+}
+
+func contains(nets []*net.IPNet, ip net.IP) bool {
+	for _, n := range nets {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,143 @@
+package coalesce
+
+import (
+	"Tages/internal/metrics"
+	"context"
+	"sync"
+	"time"
+
+	"golang.org/x/sync/singleflight"
+)
+
+// Group объединяет одновременные вызовы с одним ключом в один. Успешный
+// результат еще ttl отдается следующим вызовам без повторного запроса.
+// Результат общий для всех вызывающих, изменять его нельзя.
+type Group[T any] struct {
+	name   string
+	ttl    time.Duration
+	flight singleflight.Group
+
+	mu     sync.Mutex
+	recent map[string]recentResult[T]
+	// поколение вызова в полете по ключу, Forget его сбрасывает
+	gens map[string]uint64
+	seq  uint64
+}
+
+type recentResult[T any] struct {
+	value     T
+	expiresAt time.Time
+}
+
+// New создает группу, name - метка в метриках
+func New[T any](name string, ttl time.Duration) *Group[T] {
+	return &Group[T]{
+		name:   name,
+		ttl:    ttl,
+		recent: make(map[string]recentResult[T]),
+		gens:   make(map[string]uint64),
+	}
+}
+
+// Do выполняет fn один раз на ключ. fn получает контекст без отмены, чтобы
+// отмена первого вызова не роняла остальных, каждый ждет по своему ctx.
+func (g *Group[T]) Do(ctx context.Context, key string, fn func(ctx context.Context) (T, error)) (T, error) {
+	if v, ok := g.lookup(key); ok {
+		metrics.CoalescedCalls.WithLabelValues(g.name, "recent").Inc()
+		return v, nil
+	}
+
+	leader := false
+	ch := g.flight.DoChan(key, func() (interface{}, error) {
+		leader = true
+		gen := g.begin(key)
+		v, err := fn(context.WithoutCancel(ctx))
+		g.finish(key, gen, v, err == nil)
+		return v, err
+	})
+
+	select {
+	case <-ctx.Done():
+		var zero T
+		return zero, ctx.Err()
+	case res := <-ch:
+		if leader {
+			metrics.CoalescedCalls.WithLabelValues(g.name, "leader").Inc()
+		} else {
+			metrics.CoalescedCalls.WithLabelValues(g.name, "shared").Inc()
+		}
+		if res.Err != nil {
+			var zero T
+			return zero, res.Err
+		}
+		return res.Val.(T), nil
+	}
+}
+
+// Forget сбрасывает результат по ключу, следующий вызов пойдет в источник.
+// Результат вызова, начатого до Forget, уже не запоминается.
+func (g *Group[T]) Forget(key string) {
+	g.flight.Forget(key)
+	g.mu.Lock()
+	delete(g.recent, key)
+	delete(g.gens, key)
+	g.mu.Unlock()
+}
+
+// begin выдает вызову новое поколение по ключу
+func (g *Group[T]) begin(key string) uint64 {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.seq++
+	g.gens[key] = g.seq
+	return g.seq
+}
+
+// finish запоминает результат, только если после begin не было Forget
+// и ключ не занял более новый вызов
+func (g *Group[T]) finish(key string, gen uint64, v T, ok bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if g.gens[key] != gen {
+		return
+	}
+	delete(g.gens, key)
+	if ok {
+		g.store(key, v)
+	}
+}
+
+func (g *Group[T]) lookup(key string) (T, bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	r, ok := g.recent[key]
+	if !ok {
+		var zero T
+		return zero, false
+	}
+	if time.Now().After(r.expiresAt) {
+		delete(g.recent, key)
+		var zero T
+		return zero, false
+	}
+	return r.value, true
+}
+
+// store вызывается под mu
+func (g *Group[T]) store(key string, v T) {
+	if g.ttl <= 0 {
+		return
+	}
+
+	now := time.Now()
+	// чистим истекшие, чтобы map не росла по уникальным ключам
+	for k, r := range g.recent {
+		if now.After(r.expiresAt) {
+			delete(g.recent, k)
+		}
+	}
+	g.recent[key] = recentResult[T]{value: v, expiresAt: now.Add(g.ttl)}
+}
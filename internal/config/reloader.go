@@ -0,0 +1,182 @@
+package config
+
+import (
+	"Tages/internal/metrics"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"sync"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+)
+
+// PrepareFunc проверяет новые настройки и возвращает функцию, которая их применит.
+// Применение начинается, только если проверку прошли все подписчики.
+type PrepareFunc func(v *viper.Viper) (apply func(), err error)
+
+type subscriber struct {
+	name    string
+	prepare PrepareFunc
+}
+
+// Reloader применяет изменения файла конфигурации без перезапуска. Новый файл
+// читается в отдельный viper и попадает в активный v, только когда его приняли
+// все подписчики; значения Static ключей в v остаются прежними до перезапуска.
+type Reloader struct {
+	v        *viper.Viper
+	defaults func(v *viper.Viper)
+	logger   *logrus.Logger
+
+	mu          sync.Mutex
+	subscribers []subscriber
+	// настройки, которые требуют перезапуска
+	static  []string
+	applied map[string]interface{}
+	hash    string
+}
+
+// NewReloader - v активные настройки, defaults задает значения по умолчанию
+// для прочитанного заново файла
+func NewReloader(v *viper.Viper, defaults func(v *viper.Viper), logger *logrus.Logger) *Reloader {
+	return &Reloader{
+		v:        v,
+		defaults: defaults,
+		logger:   logger,
+	}
+}
+
+// Subscribe регистрирует обработчик изменения раздела настроек
+func (r *Reloader) Subscribe(name string, prepare PrepareFunc) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.subscribers = append(r.subscribers, subscriber{name: name, prepare: prepare})
+}
+
+// Static помечает ключи, изменение которых вступит в силу только после перезапуска
+func (r *Reloader) Static(keys ...string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.static = append(r.static, keys...)
+}
+
+// Start запоминает текущие настройки как активные и начинает следить за файлом
+func (r *Reloader) Start() {
+	r.mu.Lock()
+	r.remember()
+	r.mu.Unlock()
+
+	if r.v.ConfigFileUsed() == "" {
+		r.logger.Info("No config file, runtime reload disabled")
+		return
+	}
+
+	// за файлом следит отдельный viper: активный v меняет только Reload
+	watcher := viper.New()
+	watcher.SetConfigFile(r.v.ConfigFileUsed())
+	watcher.OnConfigChange(func(e fsnotify.Event) {
+		r.logger.WithField("file", e.Name).Info("Config file changed, reloading")
+		if err := r.Reload(); err != nil {
+			r.logger.WithError(err).Error("Config change rejected, keeping previous settings")
+		}
+	})
+	watcher.WatchConfig()
+}
+
+// Reload перечитывает файл и применяет его целиком или не применяет вовсе.
+// Отклоненный файл в активные настройки не попадает.
+func (r *Reloader) Reload() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	data, err := os.ReadFile(r.v.ConfigFileUsed())
+	if err != nil {
+		metrics.ConfigReloads.WithLabelValues("rejected").Inc()
+		return errors.Wrap(err, "cant read config file")
+	}
+	next := viper.New()
+	if r.defaults != nil {
+		r.defaults(next)
+	}
+	next.SetConfigFile(r.v.ConfigFileUsed())
+	if err := next.ReadConfig(bytes.NewReader(data)); err != nil {
+		metrics.ConfigReloads.WithLabelValues("rejected").Inc()
+		return errors.Wrap(err, "cant parse config file")
+	}
+
+	applies := make([]func(), 0, len(r.subscribers))
+	for _, s := range r.subscribers {
+		apply, err := s.prepare(next)
+		if err != nil {
+			metrics.ConfigReloads.WithLabelValues("rejected").Inc()
+			return errors.Wrapf(err, "invalid %s settings", s.name)
+		}
+		applies = append(applies, apply)
+	}
+
+	// Static ключи держим прежними, иначе их увидит код, читающий v позже
+	kept := make(map[string]interface{})
+	for _, key := range r.static {
+		old := r.v.Get(key)
+		if next.IsSet(key) && !sameValue(next.Get(key), old) {
+			r.logger.WithField("key", key).Warn("Setting changes only after restart")
+		}
+		if old != nil {
+			kept[key] = old
+		}
+	}
+
+	for _, apply := range applies {
+		if apply != nil {
+			apply()
+		}
+	}
+
+	if err := r.v.ReadConfig(bytes.NewReader(data)); err != nil {
+		// файл уже разобран в next, сюда не попадаем
+		return errors.Wrap(err, "cant parse config file")
+	}
+	for key, old := range kept {
+		r.v.Set(key, old)
+	}
+	r.remember()
+
+	metrics.ConfigReloads.WithLabelValues("applied").Inc()
+	r.logger.WithField("hash", r.hash).Info("Config reloaded")
+	return nil
+}
+
+// Applied - активные настройки и их хеш, map только для чтения
+func (r *Reloader) Applied() (map[string]interface{}, string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.applied, r.hash
+}
+
+func (r *Reloader) remember() {
+	r.applied = r.v.AllSettings()
+	r.hash = hashSettings(r.applied)
+
+	metrics.ConfigInfo.Reset()
+	metrics.ConfigInfo.WithLabelValues(r.hash).Set(1)
+}
+
+func hashSettings(settings map[string]interface{}) string {
+	// json сортирует ключи map, поэтому хеш не зависит от порядка
+	data, err := json.Marshal(settings)
+	if err != nil {
+		return "unknown"
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:6])
+}
+
+func sameValue(a, b interface{}) bool {
+	ja, errA := json.Marshal(a)
+	jb, errB := json.Marshal(b)
+	return errA == nil && errB == nil && string(ja) == string(jb)
+}
@@ -0,0 +1,202 @@
+package drain
+
+import (
+	"context"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// ErrDraining - сервер останавливается и новые передачи не принимает
+var ErrDraining = status.Error(codes.Unavailable, "server is shutting down")
+
+// Tracker учитывает идущие передачи файлов, чтобы при остановке дождаться их,
+// а по истечении срока отменить оставшиеся и удалить недописанные файлы
+type Tracker struct {
+	logger *logrus.Logger
+
+	mu       sync.Mutex
+	draining bool
+	nextID   uint64
+	active   map[uint64]*Op
+	// закрывается, когда active опустел, пересоздается при новой передаче
+	idle chan struct{}
+}
+
+func New(logger *logrus.Logger) *Tracker {
+	idle := make(chan struct{})
+	close(idle)
+	return &Tracker{
+		logger: logger,
+		active: make(map[uint64]*Op),
+		idle:   idle,
+	}
+}
+
+// Op - одна передача. Загрузка регистрирует через Track создаваемый файл
+// и после записи в БД вызывает Commit, иначе Done удалит файл.
+type Op struct {
+	t       *Tracker
+	id      uint64
+	kind    string
+	started time.Time
+	cancel  context.CancelFunc
+
+	mu        sync.Mutex
+	path      string
+	committed bool
+	done      bool
+}
+
+// Begin регистрирует передачу. Возвращенный ctx отменяется вместе с ctx
+// вызова или при Cancel. Во время остановки возвращает ErrDraining.
+func (t *Tracker) Begin(ctx context.Context, kind string) (*Op, context.Context, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.draining {
+		return nil, ctx, ErrDraining
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	t.nextID++
+	op := &Op{
+		t:       t,
+		id:      t.nextID,
+		kind:    kind,
+		started: time.Now(),
+		cancel:  cancel,
+	}
+	if len(t.active) == 0 {
+		t.idle = make(chan struct{})
+	}
+	t.active[op.id] = op
+	return op, ctx, nil
+}
+
+// Track запоминает файл, который пишет передача
+func (o *Op) Track(path string) {
+	o.mu.Lock()
+	o.path = path
+	o.mu.Unlock()
+}
+
+// Commit - файл дописан и сохранен в БД, удалять его больше нельзя
+func (o *Op) Commit() {
+	o.mu.Lock()
+	o.committed = true
+	o.mu.Unlock()
+}
+
+// Done завершает передачу и удаляет недописанный файл
+func (o *Op) Done() {
+	o.cleanup()
+	o.cancel()
+
+	t := o.t
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if _, ok := t.active[o.id]; !ok {
+		return
+	}
+	delete(t.active, o.id)
+	if len(t.active) == 0 {
+		close(t.idle)
+	}
+}
+
+// cleanup удаляет файл незавершенной передачи, true - файл был
+func (o *Op) cleanup() bool {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.done || o.committed || o.path == "" {
+		o.done = true
+		return false
+	}
+	o.done = true
+	if err := os.Remove(o.path); err != nil && !os.IsNotExist(err) {
+		o.t.logger.WithError(err).WithField("file", o.path).Warn("Failed to remove partial file")
+		return false
+	}
+	return true
+}
+
+// Active - число идущих передач
+func (t *Tracker) Active() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return len(t.active)
+}
+
+// Drain перестает принимать новые передачи, идущие продолжаются
+func (t *Tracker) Drain() {
+	t.mu.Lock()
+	t.draining = true
+	n := len(t.active)
+	t.mu.Unlock()
+
+	t.logger.WithField("in_flight", n).Info("Draining in-flight transfers")
+}
+
+// Wait ждет завершения всех передач или отмены ctx, раз в секунду пишет
+// в лог, сколько осталось
+func (t *Tracker) Wait(ctx context.Context) error {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	for {
+		t.mu.Lock()
+		idle := t.idle
+		t.mu.Unlock()
+
+		select {
+		case <-idle:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+			t.logger.WithField("in_flight", t.Active()).Info("Waiting for in-flight transfers")
+		}
+	}
+}
+
+// Cancel отменяет контексты всех идущих передач
+func (t *Tracker) Cancel() {
+	t.mu.Lock()
+	ops := make([]*Op, 0, len(t.active))
+	for _, op := range t.active {
+		ops = append(ops, op)
+	}
+	t.mu.Unlock()
+
+	for _, op := range ops {
+		t.logger.WithFields(logrus.Fields{
+			"kind":     op.kind,
+			"duration": time.Since(op.started).String(),
+		}).Warn("Cancelling transfer")
+		op.cancel()
+	}
+}
+
+// Cleanup удаляет недописанные файлы передач, которые так и не завершились,
+// возвращает число удаленных файлов
+func (t *Tracker) Cleanup() int {
+	t.mu.Lock()
+	ops := make([]*Op, 0, len(t.active))
+	for _, op := range t.active {
+		ops = append(ops, op)
+	}
+	t.mu.Unlock()
+
+	removed := 0
+	for _, op := range ops {
+		if op.cleanup() {
+			removed++
+		}
+	}
+	return removed
+}
@@ -7,9 +7,35 @@ import (
 )
 
 type File struct {
-	ID        uuid.UUID `gorm:"type:uuid;default:uuid_generate_v4();primaryKey"`
-	Name      string    `json:"name"`
-	Path      string    `json:"-"`
+	ID   uuid.UUID `gorm:"type:uuid;default:uuid_generate_v4();primaryKey"`
+	Name string    `json:"name"`
+	Path string    `json:"-"`
+	Size int64     `json:"size"`
+	// sha256 содержимого в hex
+	Checksum  string    `json:"checksum"`
 	CreatedAt time.Time `json:"created_at"`
 	UpdatedAt time.Time `json:"updated_at"`
 }
+
+// AuditEvent - одна запись журнала аудита, таблица только на добавление
+type AuditEvent struct {
+	ID            int64     `gorm:"primaryKey;autoIncrement" json:"id"`
+	OccurredAt    time.Time `gorm:"not null;index" json:"occurred_at"`
+	Actor         string    `gorm:"not null;index" json:"actor"`
+	Peer          string    `json:"peer"`
+	Method        string    `gorm:"not null" json:"method"`
+	FileName      string    `gorm:"index" json:"file_name,omitempty"`
+	Bytes         int64     `json:"bytes"`
+	Code          string    `gorm:"not null" json:"code"`
+	LatencyMicros int64     `json:"latency_us"`
+}
+
+// AuditFilter - фильтр выборки из журнала аудита, пустые поля не учитываются
+type AuditFilter struct {
+	From     time.Time
+	To       time.Time
+	Actor    string
+	FileName string
+	AfterID  int64
+	Limit    int
+}
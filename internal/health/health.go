@@ -0,0 +1,256 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/shirou/gopsutil/disk"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+// Config - настройки проверок готовности
+type Config struct {
+	Interval     time.Duration
+	Timeout      time.Duration
+	MinFreeBytes uint64
+}
+
+// LoadConfig читает раздел health:
+//
+//	health:
+//	  interval_ms: 5000
+//	  timeout_ms: 2000
+//	  min_free_bytes: 536870912
+func LoadConfig(v *viper.Viper) (Config, error) {
+	interval := v.GetInt64("health.interval_ms")
+	timeout := v.GetInt64("health.timeout_ms")
+	minFree := v.GetInt64("health.min_free_bytes")
+
+	if interval <= 0 {
+		return Config{}, errors.New("health.interval_ms must be positive")
+	}
+	if timeout < 0 || minFree < 0 {
+		return Config{}, errors.New("health.timeout_ms and health.min_free_bytes must not be negative")
+	}
+
+	return Config{
+		Interval:     time.Duration(interval) * time.Millisecond,
+		Timeout:      time.Duration(timeout) * time.Millisecond,
+		MinFreeBytes: uint64(minFree),
+	}, nil
+}
+
+// Check - одна проверка готовности, nil - все в порядке
+type Check func(ctx context.Context) error
+
+type namedCheck struct {
+	name  string
+	check Check
+}
+
+// Checker собирает проверки готовности и отдает их через grpc.health.v1,
+// /healthz и /readyz. После Shutdown инстанс всегда NOT_SERVING.
+type Checker struct {
+	logger   *logrus.Logger
+	server   *health.Server
+	services []string
+	timeout  time.Duration
+
+	mu     sync.RWMutex
+	checks []namedCheck
+
+	shutdown atomic.Bool
+}
+
+func New(logger *logrus.Logger, timeout time.Duration, services ...string) *Checker {
+	if timeout <= 0 {
+		timeout = 2 * time.Second
+	}
+	c := &Checker{
+		logger:   logger,
+		server:   health.NewServer(),
+		services: append([]string{""}, services...),
+		timeout:  timeout,
+	}
+	// пока проверки не прошли ни разу, трафик не принимаем
+	c.setStatus(healthpb.HealthCheckResponse_NOT_SERVING)
+	return c
+}
+
+// Add регистрирует проверку готовности
+func (c *Checker) Add(name string, check Check) {
+	c.mu.Lock()
+	c.checks = append(c.checks, namedCheck{name: name, check: check})
+	c.mu.Unlock()
+}
+
+// Server - реализация grpc.health.v1 для регистрации на gRPC-сервере
+func (c *Checker) Server() healthpb.HealthServer {
+	return c.server
+}
+
+// Ready выполняет все проверки, в результате текст ошибки или "ok" по каждой
+func (c *Checker) Ready(ctx context.Context) (map[string]string, bool) {
+	c.mu.RLock()
+	checks := append([]namedCheck(nil), c.checks...)
+	c.mu.RUnlock()
+
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	type result struct {
+		name string
+		err  error
+	}
+	results := make(chan result, len(checks))
+	for _, nc := range checks {
+		go func() {
+			results <- result{name: nc.name, err: nc.check(ctx)}
+		}()
+	}
+
+	report := make(map[string]string, len(checks)+1)
+	ready := true
+	for range checks {
+		r := <-results
+		if r.err != nil {
+			ready = false
+			report[r.name] = r.err.Error()
+			continue
+		}
+		report[r.name] = "ok"
+	}
+
+	if c.shutdown.Load() {
+		ready = false
+		report["shutdown"] = "shutting down"
+	}
+	return report, ready
+}
+
+// Run периодически пересчитывает готовность и обновляет статус gRPC
+func (c *Checker) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	wasReady := false
+	for {
+		report, ready := c.Ready(ctx)
+		if c.shutdown.Load() {
+			return
+		}
+		if ready != wasReady {
+			c.logger.WithField("checks", report).WithField("ready", ready).Info("Readiness changed")
+			wasReady = ready
+		}
+		if ready {
+			c.setStatus(healthpb.HealthCheckResponse_SERVING)
+		} else {
+			c.setStatus(healthpb.HealthCheckResponse_NOT_SERVING)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Shutdown переводит инстанс в NOT_SERVING до конца жизни процесса,
+// вызывается перед GracefulStop, чтобы балансировщики сняли трафик
+func (c *Checker) Shutdown() {
+	c.shutdown.Store(true)
+	c.server.Shutdown()
+}
+
+func (c *Checker) setStatus(st healthpb.HealthCheckResponse_ServingStatus) {
+	for _, svc := range c.services {
+		c.server.SetServingStatus(svc, st)
+	}
+}
+
+// LiveHandler - /healthz: процесс жив и отвечает
+func (c *Checker) LiveHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write([]byte("ok\n"))
+	})
+}
+
+// ReadyHandler - /readyz: 200, если все проверки прошли, иначе 503
+func (c *Checker) ReadyHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		report, ready := c.Ready(r.Context())
+
+		w.Header().Set("Content-Type", "application/json")
+		if !ready {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		_ = json.NewEncoder(w).Encode(report)
+	})
+}
+
+// IsHealthMethod - вызов сервиса grpc.health.v1, он не проходит аудит и лимиты
+func IsHealthMethod(fullMethod string) bool {
+	return strings.HasPrefix(fullMethod, "/"+healthpb.Health_ServiceDesc.ServiceName+"/")
+}
+
+// DirWritable проверяет, что в dir можно создать файл
+func DirWritable(dir string) Check {
+	return func(ctx context.Context) error {
+		f, err := os.CreateTemp(dir, ".readyz-*")
+		if err != nil {
+			return errors.Wrap(err, "upload dir is not writable")
+		}
+		name := f.Name()
+		f.Close()
+		return os.Remove(filepath.Clean(name))
+	}
+}
+
+// FreeDisk проверяет, что на разделе с dir свободно не меньше minFree байт
+func FreeDisk(dir string, minFree uint64) Check {
+	return func(ctx context.Context) error {
+		usage, err := disk.UsageWithContext(ctx, dir)
+		if err != nil {
+			return errors.Wrap(err, "cant get disk usage")
+		}
+		if usage.Free < minFree {
+			return errors.Errorf("only %d bytes free, need %d", usage.Free, minFree)
+		}
+		return nil
+	}
+}
+
+// Flag - проверка, которая проходит после Set, например прогрев кеша
+type Flag struct {
+	name string
+	done atomic.Bool
+}
+
+func NewFlag(name string) *Flag {
+	return &Flag{name: name}
+}
+
+func (f *Flag) Set() {
+	f.done.Store(true)
+}
+
+func (f *Flag) Check(ctx context.Context) error {
+	if !f.done.Load() {
+		return errors.Errorf("%s not finished", f.name)
+	}
+	return nil
+}
@@ -0,0 +1,38 @@
+package health
+
+import (
+	"context"
+
+	"google.golang.org/grpc"
+)
+
+// SkipUnary пропускает вызовы grpc.health.v1 мимо interceptor: пробы
+// балансировщика не должны попадать в аудит и расходовать лимиты клиентов
+func SkipUnary(next grpc.UnaryServerInterceptor) grpc.UnaryServerInterceptor {
+	return func(
+		ctx context.Context,
+		req interface{},
+		info *grpc.UnaryServerInfo,
+		handler grpc.UnaryHandler,
+	) (interface{}, error) {
+		if IsHealthMethod(info.FullMethod) {
+			return handler(ctx, req)
+		}
+		return next(ctx, req, info, handler)
+	}
+}
+
+// SkipStream - то же для потоковых вызовов (Health.Watch)
+func SkipStream(next grpc.StreamServerInterceptor) grpc.StreamServerInterceptor {
+	return func(
+		srv interface{},
+		ss grpc.ServerStream,
+		info *grpc.StreamServerInfo,
+		handler grpc.StreamHandler,
+	) error {
+		if IsHealthMethod(info.FullMethod) {
+			return handler(srv, ss)
+		}
+		return next(srv, ss, info, handler)
+	}
+}
@@ -0,0 +1,106 @@
+package metrics
+
+import (
+	"runtime"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Старые имена метрик: apps_image_* для БД и backend_runtime_* для рантайма.
+// Экспортируются, пока включен legacy_metrics, чтобы дашборды и алерты
+// успели перейти на apps_storage_*, apps_db_* и стандартные go_*/process_*.
+// После переходного периода файл удаляется целиком.
+
+var (
+	legacyDbOperationsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "apps",
+		Subsystem: "image",
+		Name:      "operation_total_db",
+		Help:      "Deprecated: use apps_storage_operations_total",
+	}, []string{"status", "operation"})
+
+	legacyDbOperationDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: "apps",
+		Subsystem: "image",
+		Name:      "operation_db_duration_seconds",
+		Help:      "Deprecated: use apps_storage_operation_duration_seconds",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"status", "operation"})
+)
+
+// RegisterLegacy регистрирует метрики со старыми именами
+func RegisterLegacy(reg prometheus.Registerer) {
+	reg.MustRegister(legacyDbOperationsTotal, legacyDbOperationDuration, newLegacyRuntimeCollector())
+}
+
+func legacyRuntimeDesc(name, help string) *prometheus.Desc {
+	return prometheus.NewDesc(
+		prometheus.BuildFQName("backend", "runtime", name),
+		"Deprecated: "+help, nil, nil,
+	)
+}
+
+// legacyRuntimeCollector отдает backend_runtime_* из runtime.MemStats в момент
+// сбора, без отдельной горутины
+type legacyRuntimeCollector struct {
+	gcRuns      *prometheus.Desc
+	gcTotalTime *prometheus.Desc
+	alloc       *prometheus.Desc
+	heapInuse   *prometheus.Desc
+	heapObjects *prometheus.Desc
+
+	mu        sync.Mutex
+	lastNumGC uint32
+	gcPause   prometheus.Histogram
+}
+
+func newLegacyRuntimeCollector() *legacyRuntimeCollector {
+	return &legacyRuntimeCollector{
+		gcRuns:      legacyRuntimeDesc("gc_runs_total", "use go_gc_duration_seconds_count"),
+		gcTotalTime: legacyRuntimeDesc("gc_totak_time_seconds", "use go_gc_duration_seconds_sum"),
+		alloc:       legacyRuntimeDesc("go_memstats_alloc_bytes", "use go_memstats_alloc_bytes"),
+		heapInuse:   legacyRuntimeDesc("go_memstats_heap_inuse_bytes", "use go_memstats_heap_inuse_bytes"),
+		heapObjects: legacyRuntimeDesc("go_memstats_heap_objects", "use go_memstats_heap_objects"),
+		gcPause: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Namespace: "backend",
+			Subsystem: "runtime",
+			Name:      "gc_pause_duration_seconds",
+			Help:      "Deprecated: use go_gc_duration_seconds",
+			Buckets:   []float64{0.001, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1.0},
+		}),
+	}
+}
+
+func (c *legacyRuntimeCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.gcRuns
+	ch <- c.gcTotalTime
+	ch <- c.alloc
+	ch <- c.heapInuse
+	ch <- c.heapObjects
+	c.gcPause.Describe(ch)
+}
+
+func (c *legacyRuntimeCollector) Collect(ch chan<- prometheus.Metric) {
+	var stats runtime.MemStats
+	runtime.ReadMemStats(&stats)
+
+	c.mu.Lock()
+	// паузы циклов с прошлого сбора, PauseNs хранит последние 256
+	from := c.lastNumGC
+	if stats.NumGC-from > 256 {
+		from = stats.NumGC - 256
+	}
+	for n := from + 1; n <= stats.NumGC; n++ {
+		c.gcPause.Observe(float64(stats.PauseNs[(n+255)%256]) / 1e9)
+	}
+	c.lastNumGC = stats.NumGC
+	c.mu.Unlock()
+
+	ch <- prometheus.MustNewConstMetric(c.gcRuns, prometheus.CounterValue, float64(stats.NumGC))
+	ch <- prometheus.MustNewConstMetric(c.gcTotalTime, prometheus.CounterValue, float64(stats.PauseTotalNs)/1e9)
+	ch <- prometheus.MustNewConstMetric(c.alloc, prometheus.GaugeValue, float64(stats.Alloc))
+	ch <- prometheus.MustNewConstMetric(c.heapInuse, prometheus.GaugeValue, float64(stats.HeapInuse))
+	ch <- prometheus.MustNewConstMetric(c.heapObjects, prometheus.GaugeValue, float64(stats.HeapObjects))
+	c.gcPause.Collect(ch)
+}
@@ -2,10 +2,10 @@ package metrics
 
 import (
 	"context"
-	"runtime"
 	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
 	"github.com/shirou/gopsutil/mem"
 	"github.com/sirupsen/logrus"
 	"google.golang.org/grpc"
@@ -13,22 +13,42 @@ import (
 )
 
 var (
-	DbOperationsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+	StorageOperations = prometheus.NewCounterVec(prometheus.CounterOpts{
 		Namespace: "apps",
-		Subsystem: "image",
-		Name:      "operation_total_db",
-		Help:      "Total operation of DB by type",
-	},
-		[]string{"status", "operation"})
+		Subsystem: "storage",
+		Name:      "operations_total",
+		Help:      "Storage operations by operation and status (success, not_found, error)",
+	}, []string{"operation", "status"})
 
-	DbOperationDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+	StorageOperationDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
 		Namespace: "apps",
-		Subsystem: "image",
-		Name:      "operation_db_duration_seconds",
-		Help:      "Duration of DB operations",
+		Subsystem: "storage",
+		Name:      "operation_duration_seconds",
+		Help:      "Duration of storage operations, including transactions they run in",
 		Buckets:   prometheus.DefBuckets,
-	},
-		[]string{"status", "operation"})
+	}, []string{"operation", "status"})
+
+	StorageTxRetries = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "apps",
+		Subsystem: "storage",
+		Name:      "tx_retries_total",
+		Help:      "Transactions retried after a serialization failure or deadlock",
+	})
+
+	DBQueries = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "apps",
+		Subsystem: "db",
+		Name:      "queries_total",
+		Help:      "SQL statements by operation (create, query, update, delete, row, raw), table and outcome",
+	}, []string{"operation", "table", "outcome"})
+
+	DBQueryDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: "apps",
+		Subsystem: "db",
+		Name:      "query_duration_seconds",
+		Help:      "Duration of SQL statements",
+		Buckets:   prometheus.ExponentialBuckets(0.0005, 2, 14),
+	}, []string{"operation", "table", "outcome"})
 
 	grpcErrorCounter = prometheus.NewCounterVec(
 		prometheus.CounterOpts{
@@ -39,55 +59,255 @@ var (
 		}, []string{"method", "code"},
 	)
 
-	gcFrequency = prometheus.NewCounter(
+	AuditEventsTotal = prometheus.NewCounterVec(
 		prometheus.CounterOpts{
-			Namespace: "backend",
-			Subsystem: "runtime",
-			Name:      "gc_runs_total",
-			Help:      "Total number of gc runs",
-		})
+			Namespace: "apps",
+			Subsystem: "audit",
+			Name:      "events_total",
+			Help:      "Audit events by result (written, failed, dropped)",
+		}, []string{"result"},
+	)
+
+	AuditQueueDepth = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: "apps",
+		Subsystem: "audit",
+		Name:      "queue_depth",
+		Help:      "Audit events waiting to be written",
+	})
 
-	gcTotalTime = prometheus.NewCounter(
+	BandwidthThrottledSeconds = prometheus.NewCounterVec(
 		prometheus.CounterOpts{
-			Namespace: "backend",
-			Subsystem: "runtime",
-			Name:      "gc_totak_time_seconds",
-			Help:      "Total time spent in GC",
-		})
-
-	memAlloc = prometheus.NewGauge(prometheus.GaugeOpts{
-		Namespace: "backend",
-		Subsystem: "runtime",
-		Name:      "go_memstats_alloc_bytes",
-		Help:      "Current memory allocated and still in use.",
+			Namespace: "apps",
+			Subsystem: "bandwidth",
+			Name:      "throttled_seconds_total",
+			Help:      "Time stream messages were delayed by bandwidth limits",
+		}, []string{"method", "direction"},
+	)
+
+	RateLimitBackendFallback = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "apps",
+		Subsystem: "ratelimiter",
+		Name:      "backend_fallback_total",
+		Help:      "Times the shared rate-limit backend failed and local buckets were used",
+	})
+
+	AdmissionQueueDepth = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "apps",
+		Subsystem: "admission",
+		Name:      "queue_depth",
+		Help:      "Calls waiting for a transfer slot",
+	}, []string{"pool"})
+
+	AdmissionInUse = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "apps",
+		Subsystem: "admission",
+		Name:      "slots_in_use",
+		Help:      "Transfer slots currently taken",
+	}, []string{"pool"})
+
+	AdmissionRejected = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "apps",
+		Subsystem: "admission",
+		Name:      "rejected_total",
+		Help:      "Calls that left the queue without a slot",
+	}, []string{"pool", "reason"})
+
+	OverloadLevel = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: "apps",
+		Subsystem: "overload",
+		Name:      "level",
+		Help:      "Resource pressure level: 0 none, 1 elevated, 2 critical",
+	})
+
+	OverloadLimit = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: "apps",
+		Subsystem: "overload",
+		Name:      "concurrency_limit",
+		Help:      "Adaptive limit of concurrent calls",
+	})
+
+	OverloadInFlight = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: "apps",
+		Subsystem: "overload",
+		Name:      "in_flight",
+		Help:      "Calls currently admitted by the overload controller",
+	})
+
+	OverloadShed = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "apps",
+		Subsystem: "overload",
+		Name:      "shed_total",
+		Help:      "Calls rejected by the overload controller",
+	}, []string{"method", "priority"})
+
+	ConfigInfo = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "apps",
+		Subsystem: "config",
+		Name:      "info",
+		Help:      "Hash of the active configuration, always 1",
+	}, []string{"hash"})
+
+	ConfigReloads = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "apps",
+		Subsystem: "config",
+		Name:      "reloads_total",
+		Help:      "Config reload attempts by result (applied, rejected)",
+	}, []string{"result"})
+
+	CacheRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "apps",
+		Subsystem: "cache",
+		Name:      "requests_total",
+		Help:      "Cache lookups by operation (get, list) and result (hit, miss)",
+	}, []string{"op", "result"})
+
+	CacheEvictions = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "apps",
+		Subsystem: "cache",
+		Name:      "evictions_total",
+		Help:      "Cache entries evicted by reason (size, ttl, pressure)",
+	}, []string{"reason"})
+
+	CacheEntries = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: "apps",
+		Subsystem: "cache",
+		Name:      "entries",
+		Help:      "Entries currently in the metadata cache",
+	})
+
+	CacheBytes = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: "apps",
+		Subsystem: "cache",
+		Name:      "bytes",
+		Help:      "Approximate size of the metadata cache",
 	})
 
-	memHeapInuse = prometheus.NewGauge(prometheus.GaugeOpts{
-		Namespace: "backend",
-		Subsystem: "runtime",
-		Name:      "go_memstats_heap_inuse_bytes",
-		Help:      "Heap memory in use.",
+	CacheState = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: "apps",
+		Subsystem: "cache",
+		Name:      "state",
+		Help:      "Cache state under memory pressure: 0 enabled, 1 degraded, 2 disabled",
 	})
 
-	memHeapObjects = prometheus.NewGauge(prometheus.GaugeOpts{
-		Namespace: "backend",
-		Subsystem: "runtime",
-		Name:      "go_memstats_heap_objects",
-		Help:      "Number of allocated heap objects.",
+	CacheStateTransitions = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "apps",
+		Subsystem: "cache",
+		Name:      "state_transitions_total",
+		Help:      "Cache state transitions",
+	}, []string{"from", "to"})
+
+	CacheContentRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "apps",
+		Subsystem: "cache",
+		Name:      "content_requests_total",
+		Help:      "File content cache lookups by result (hit, miss)",
+	}, []string{"result"})
+
+	CacheContentEvictions = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "apps",
+		Subsystem: "cache",
+		Name:      "content_evictions_total",
+		Help:      "File content cache entries evicted to stay within the byte budget",
 	})
 
-	gcPauseDuration = prometheus.NewHistogram(prometheus.HistogramOpts{
-		Namespace: "backend",
-		Subsystem: "runtime",
-		Name:      "gc_pause_duration_seconds",
-		Help:      "GC pause duration in seconds",
-		Buckets:   []float64{0.001, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1.0},
+	CacheContentBytes = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: "apps",
+		Subsystem: "cache",
+		Name:      "content_bytes",
+		Help:      "Bytes held by the file content cache",
 	})
+
+	CacheNotifyEvents = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "apps",
+		Subsystem: "cache",
+		Name:      "notify_events_total",
+		Help:      "File change events received from other replicas via LISTEN/NOTIFY",
+	}, []string{"op"})
+
+	CacheNotifyReconnects = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "apps",
+		Subsystem: "cache",
+		Name:      "notify_reconnects_total",
+		Help:      "File event listener connection losses",
+	})
+
+	CacheNotifyResyncs = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "apps",
+		Subsystem: "cache",
+		Name:      "notify_resyncs_total",
+		Help:      "Full cache resyncs each time the listener subscribed",
+	})
+
+	CacheBackendErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "apps",
+		Subsystem: "cache",
+		Name:      "backend_errors_total",
+		Help:      "Remote cache operations that fell back to the database, by operation and reason (error, open)",
+	}, []string{"op", "reason"})
+
+	CacheBackendBreakerOpen = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: "apps",
+		Subsystem: "cache",
+		Name:      "backend_breaker_open",
+		Help:      "1 while the remote cache circuit breaker is open",
+	})
+
+	CoalescedCalls = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "apps",
+		Subsystem: "coalesce",
+		Name:      "calls_total",
+		Help:      "Coalesced calls by group and role: leader ran the call, shared waited for it, recent reused a fresh result",
+	}, []string{"group", "role"})
+
+	TransferBytes = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "apps",
+		Subsystem: "transfer",
+		Name:      "bytes_total",
+		Help:      "Bytes uploaded or downloaded, by method, including failed transfers",
+	}, []string{"method"})
+
+	TransferFileSize = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: "apps",
+		Subsystem: "transfer",
+		Name:      "file_size_bytes",
+		Help:      "Size of completed transfers",
+		// 1KB .. 1GB
+		Buckets: prometheus.ExponentialBuckets(1024, 4, 11),
+	}, []string{"method"})
+
+	TransferChunks = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: "apps",
+		Subsystem: "transfer",
+		Name:      "chunks",
+		Help:      "Chunks per completed transfer",
+		Buckets:   prometheus.ExponentialBuckets(1, 4, 9),
+	}, []string{"method"})
+
+	TransferChunkLatency = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: "apps",
+		Subsystem: "transfer",
+		Name:      "chunk_duration_seconds",
+		Help:      "Time between consecutive chunks of a transfer",
+		Buckets:   prometheus.ExponentialBuckets(0.0005, 2, 14),
+	}, []string{"method"})
+
+	TransferThroughput = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: "apps",
+		Subsystem: "transfer",
+		Name:      "throughput_bytes_per_second",
+		Help:      "Average throughput of completed transfers",
+		// 64KB/s .. 1GB/s
+		Buckets: prometheus.ExponentialBuckets(64*1024, 2, 15),
+	}, []string{"method"})
 )
 
 func DBMetricsFunc(status, operation string, start time.Time) {
-	DbOperationsTotal.WithLabelValues(status, operation).Inc()
-	DbOperationDuration.WithLabelValues(status, operation).Observe(time.Since(start).Seconds())
+	elapsed := time.Since(start).Seconds()
+	StorageOperations.WithLabelValues(operation, status).Inc()
+	StorageOperationDuration.WithLabelValues(operation, status).Observe(elapsed)
+
+	legacyDbOperationsTotal.WithLabelValues(status, operation).Inc()
+	legacyDbOperationDuration.WithLabelValues(status, operation).Observe(elapsed)
 }
 
 func UnaryErrorMetricsInterceptor() grpc.UnaryServerInterceptor {
@@ -113,62 +333,58 @@ func StreamErrorMetricsInterceptor() grpc.StreamServerInterceptor {
 }
 
 func Initalize(reg *prometheus.Registry) {
-	reg.MustRegister(grpcErrorCounter, DbOperationsTotal, DbOperationDuration, gcPauseDuration, gcFrequency, gcTotalTime, memAlloc, memHeapInuse, memHeapObjects)
+	reg.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+	reg.MustRegister(grpcErrorCounter)
+	reg.MustRegister(StorageOperations, StorageOperationDuration, StorageTxRetries, DBQueries, DBQueryDuration)
+	reg.MustRegister(AuditEventsTotal, AuditQueueDepth)
+	reg.MustRegister(BandwidthThrottledSeconds, RateLimitBackendFallback)
+	reg.MustRegister(AdmissionQueueDepth, AdmissionInUse, AdmissionRejected)
+	reg.MustRegister(OverloadLevel, OverloadLimit, OverloadInFlight, OverloadShed)
+	reg.MustRegister(ConfigInfo, ConfigReloads)
+	reg.MustRegister(CacheRequests, CacheEvictions, CacheEntries, CacheBytes)
+	reg.MustRegister(CacheState, CacheStateTransitions)
+	reg.MustRegister(CacheContentRequests, CacheContentEvictions, CacheContentBytes)
+	reg.MustRegister(CacheNotifyEvents, CacheNotifyReconnects, CacheNotifyResyncs)
+	reg.MustRegister(CacheBackendErrors, CacheBackendBreakerOpen)
+	reg.MustRegister(CoalescedCalls)
+	reg.MustRegister(TransferBytes, TransferFileSize, TransferChunks, TransferChunkLatency, TransferThroughput)
 }
 
-func CollectorGCHeapMetrics(ctx context.Context, log *logrus.Logger, ch chan bool) {
-	log.Info("GC metrics started")
+// WatchMemory раз в interval отправляет в ch процент занятой памяти системы,
+// по нему кеш переходит в degraded и disabled
+func WatchMemory(ctx context.Context, log *logrus.Logger, ch chan float64, interval time.Duration) {
+	log.Info("Memory watcher started")
 
-	var stats runtime.MemStats
-	// количество GC циклов
-	var lastnumGC uint32
-	// общее время пауз на предидущих измирениях
-	var lastPauseTotal time.Duration
-
-	ticker := time.NewTicker(15 * time.Second)
+	ticker := time.NewTicker(interval)
 	defer ticker.Stop()
 
 	for {
 		select {
 		case <-ctx.Done():
-			log.Info("GC metrics Stoped")
+			log.Info("Memory watcher stopped")
 			return
 		case <-ticker.C:
-			runtime.ReadMemStats(&stats)
-
-			if stats.NumGC > lastnumGC {
-				NewGcRuns := stats.NumGC - lastnumGC
-				gcFrequency.Add(float64(NewGcRuns))
-
-				lastPauseNs := stats.PauseNs[(stats.NumGC+255)%256]
-				gcPauseDuration.Observe(float64(lastPauseNs) / 1e9)
-
-				lastnumGC = stats.NumGC
-			}
-
-			if stats.PauseTotalNs > uint64(lastPauseTotal) {
-				newPauseTime := time.Duration(stats.PauseTotalNs) - lastPauseTotal
-				gcTotalTime.Add(newPauseTime.Seconds())
-				lastPauseTotal = time.Duration(stats.PauseTotalNs)
-			}
-
-			memAlloc.Set(float64(stats.Alloc))
-			memHeapInuse.Set(float64(stats.HeapInuse))
-			memHeapObjects.Set(float64(stats.HeapObjects))
-
 			vmStat, err := mem.VirtualMemory()
 			if err != nil {
-				log.Warnf("failed to get system memory: %v", err)
+				log.WithError(err).Warn("Failed to get system memory")
 				continue
 			}
 
 			if vmStat.UsedPercent >= 70 {
 				log.Warnf("Memory usage high: %.2f%%", vmStat.UsedPercent)
-				select {
-				case ch <- false:
-				default:
+			}
 
-				}
+			// старый замер уже не нужен, заменяем его свежим
+			select {
+			case <-ch:
+			default:
+			}
+			select {
+			case ch <- vmStat.UsedPercent:
+			default:
 			}
 		}
 	}
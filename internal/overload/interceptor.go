@@ -0,0 +1,113 @@
+package overload
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/proto"
+)
+
+func (c *Controller) UnaryInterceptor() grpc.UnaryServerInterceptor {
+	return func(
+		ctx context.Context,
+		req interface{},
+		info *grpc.UnaryServerInfo,
+		handler grpc.UnaryHandler,
+	) (interface{}, error) {
+		size := messageSize(req)
+		if err := c.admit(info.FullMethod, size); err != nil {
+			return nil, err
+		}
+
+		start := time.Now()
+		resp, err := handler(ctx, req)
+		c.done(size, time.Since(start))
+		return resp, err
+	}
+}
+
+// в стриме в памяти держится последний полученный чанк. Задержка стрима -
+// среднее время обработки полученного сообщения: от возврата RecvMsg до
+// следующего RecvMsg или SendMsg. Для скачивания это время до первого чанка,
+// для загрузки - запись чанка, ожидание клиента не учитывается.
+type trackedStream struct {
+	grpc.ServerStream
+	c    *Controller
+	held int64
+
+	mu     sync.Mutex
+	recvAt time.Time
+	busy   time.Duration
+	steps  int
+}
+
+func (s *trackedStream) RecvMsg(m interface{}) error {
+	s.mark()
+	err := s.ServerStream.RecvMsg(m)
+	size := int64(0)
+	if err == nil {
+		size = messageSize(m)
+	}
+	s.c.addBytes(size - s.held)
+	s.held = size
+
+	s.mu.Lock()
+	s.recvAt = time.Now()
+	s.mu.Unlock()
+	return err
+}
+
+func (s *trackedStream) SendMsg(m interface{}) error {
+	s.mark()
+	return s.ServerStream.SendMsg(m)
+}
+
+// mark закрывает интервал обработки последнего полученного сообщения
+func (s *trackedStream) mark() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.recvAt.IsZero() {
+		return
+	}
+	s.busy += time.Since(s.recvAt)
+	s.steps++
+	s.recvAt = time.Time{}
+}
+
+func (s *trackedStream) latency() time.Duration {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.steps == 0 {
+		return 0
+	}
+	return s.busy / time.Duration(s.steps)
+}
+
+func (c *Controller) StreamInterceptor() grpc.StreamServerInterceptor {
+	return func(
+		srv interface{},
+		ss grpc.ServerStream,
+		info *grpc.StreamServerInfo,
+		handler grpc.StreamHandler,
+	) error {
+		if err := c.admit(info.FullMethod, 0); err != nil {
+			return err
+		}
+
+		stream := &trackedStream{ServerStream: ss, c: c}
+		err := handler(srv, stream)
+		// длительность стрима зависит от размера файла, в задержку идет
+		// только время обработки сообщений
+		c.done(stream.held, stream.latency())
+		return err
+	}
+}
+
+func messageSize(m interface{}) int64 {
+	if msg, ok := m.(proto.Message); ok {
+		return int64(proto.Size(msg))
+	}
+	return 0
+}
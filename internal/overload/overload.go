@@ -0,0 +1,335 @@
+package overload
+
+import (
+	"Tages/internal/metrics"
+	"context"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/shirou/gopsutil/mem"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+type Priority int
+
+const (
+	Low Priority = iota
+	Normal
+	High
+)
+
+func (p Priority) String() string {
+	switch p {
+	case Low:
+		return "low"
+	case High:
+		return "high"
+	default:
+		return "normal"
+	}
+}
+
+func ParsePriority(s string) (Priority, error) {
+	switch strings.ToLower(s) {
+	case "low":
+		return Low, nil
+	case "normal":
+		return Normal, nil
+	case "high":
+		return High, nil
+	}
+	return Normal, errors.Errorf("unknown priority %q", s)
+}
+
+// доля лимита одновременных вызовов, доступная приоритету
+var limitShare = map[Priority]float64{
+	Low:    0.5,
+	Normal: 0.8,
+	High:   1,
+}
+
+// Level - уровень нагрузки по ресурсам
+type Level int
+
+const (
+	LevelNone Level = iota
+	LevelElevated
+	LevelCritical
+)
+
+func (l Level) String() string {
+	switch l {
+	case LevelElevated:
+		return "elevated"
+	case LevelCritical:
+		return "critical"
+	default:
+		return "none"
+	}
+}
+
+type Config struct {
+	MemoryHighPercent     float64
+	MemoryCriticalPercent float64
+	MaxGoroutines         int
+	MaxInFlightBytes      int64
+	// целевая задержка унарных вызовов, выше нее лимит снижается
+	TargetLatency  time.Duration
+	MinLimit       int
+	MaxLimit       int
+	SampleInterval time.Duration
+	// приоритеты по полному имени метода, остальные - Normal
+	Priorities map[string]Priority
+}
+
+// Sample - замер ресурсов процесса
+type Sample struct {
+	MemoryPercent float64
+	Goroutines    int
+}
+
+// Controller сбрасывает вызовы при перегрузке. Лимит одновременных вызовов
+// подстраивается по AIMD: растет на 1 за замер, пока задержка в норме и нет
+// давления по ресурсам, и умножается на 0.9, когда задержка или ресурсы выходят
+// за пороги. Низкий приоритет сбрасывается первым.
+type Controller struct {
+	cfg    Config
+	logger *logrus.Logger
+
+	mu            sync.Mutex
+	limit         float64
+	inFlight      int
+	inFlightBytes int64
+	latency       time.Duration
+	level         Level
+}
+
+func New(cfg Config, logger *logrus.Logger) *Controller {
+	if cfg.MinLimit <= 0 {
+		cfg.MinLimit = 1
+	}
+	if cfg.MaxLimit < cfg.MinLimit {
+		cfg.MaxLimit = cfg.MinLimit
+	}
+	if cfg.SampleInterval <= 0 {
+		cfg.SampleInterval = time.Second
+	}
+	return &Controller{
+		cfg:    cfg,
+		logger: logger,
+		limit:  float64(cfg.MaxLimit),
+	}
+}
+
+// LoadConfig читает раздел overload
+func LoadConfig(v *viper.Viper) (Config, error) {
+	cfg := Config{
+		MemoryHighPercent:     v.GetFloat64("overload.memory_high_percent"),
+		MemoryCriticalPercent: v.GetFloat64("overload.memory_critical_percent"),
+		MaxGoroutines:         v.GetInt("overload.max_goroutines"),
+		MaxInFlightBytes:      v.GetInt64("overload.max_inflight_bytes"),
+		TargetLatency:         time.Duration(v.GetInt("overload.target_latency_ms")) * time.Millisecond,
+		MinLimit:              v.GetInt("overload.min_limit"),
+		MaxLimit:              v.GetInt("overload.max_limit"),
+		SampleInterval:        time.Duration(v.GetInt("overload.sample_interval_ms")) * time.Millisecond,
+		Priorities:            make(map[string]Priority),
+	}
+
+	var priorities []struct {
+		Method   string `mapstructure:"method"`
+		Priority string `mapstructure:"priority"`
+	}
+	if err := v.UnmarshalKey("overload.priorities", &priorities); err != nil {
+		return Config{}, errors.Wrap(err, "cant parse overload.priorities")
+	}
+	for _, p := range priorities {
+		prio, err := ParsePriority(p.Priority)
+		if err != nil {
+			return Config{}, errors.Wrapf(err, "invalid priority for %s", p.Method)
+		}
+		cfg.Priorities[p.Method] = prio
+	}
+	return cfg, nil
+}
+
+// Run раз в SampleInterval снимает замер памяти и горутин
+func (c *Controller) Run(ctx context.Context) {
+	ticker := time.NewTicker(c.cfg.SampleInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			sample := Sample{Goroutines: runtime.NumGoroutine()}
+			vmStat, err := mem.VirtualMemory()
+			if err != nil {
+				c.logger.WithError(err).Warn("Failed to get system memory for overload control")
+			} else {
+				sample.MemoryPercent = vmStat.UsedPercent
+			}
+			c.Observe(sample)
+		}
+	}
+}
+
+// Observe пересчитывает уровень нагрузки и лимит по новому замеру
+func (c *Controller) Observe(s Sample) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	level := LevelNone
+	raise := func(l Level) {
+		if l > level {
+			level = l
+		}
+	}
+
+	if c.cfg.MemoryCriticalPercent > 0 && s.MemoryPercent >= c.cfg.MemoryCriticalPercent {
+		raise(LevelCritical)
+	} else if c.cfg.MemoryHighPercent > 0 && s.MemoryPercent >= c.cfg.MemoryHighPercent {
+		raise(LevelElevated)
+	}
+	if c.cfg.MaxGoroutines > 0 {
+		if s.Goroutines >= c.cfg.MaxGoroutines {
+			raise(LevelCritical)
+		} else if s.Goroutines*10 >= c.cfg.MaxGoroutines*8 {
+			raise(LevelElevated)
+		}
+	}
+	if c.cfg.MaxInFlightBytes > 0 {
+		if c.inFlightBytes >= c.cfg.MaxInFlightBytes {
+			raise(LevelCritical)
+		} else if c.inFlightBytes*10 >= c.cfg.MaxInFlightBytes*8 {
+			raise(LevelElevated)
+		}
+	}
+
+	slow := c.cfg.TargetLatency > 0 && c.latency > c.cfg.TargetLatency
+	if level == LevelNone && !slow {
+		c.limit++
+	} else {
+		c.limit *= 0.9
+	}
+	if c.limit > float64(c.cfg.MaxLimit) {
+		c.limit = float64(c.cfg.MaxLimit)
+	}
+	if c.limit < float64(c.cfg.MinLimit) {
+		c.limit = float64(c.cfg.MinLimit)
+	}
+
+	if level != c.level {
+		c.logger.WithFields(logrus.Fields{
+			"from":           c.level,
+			"to":             level,
+			"memory_percent": s.MemoryPercent,
+			"goroutines":     s.Goroutines,
+			"inflight_bytes": c.inFlightBytes,
+		}).Warn("Overload level changed")
+	}
+	c.level = level
+
+	metrics.OverloadLevel.Set(float64(level))
+	metrics.OverloadLimit.Set(c.limit)
+}
+
+// Limit - текущий лимит одновременных вызовов
+func (c *Controller) Limit() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return int(c.limit)
+}
+
+// Level - текущий уровень нагрузки
+func (c *Controller) Level() Level {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.level
+}
+
+func (c *Controller) priority(method string) Priority {
+	if p, ok := c.cfg.Priorities[method]; ok {
+		return p
+	}
+	return Normal
+}
+
+// admit решает, пускать ли вызов. bytes - объем данных, который вызов держит в памяти.
+func (c *Controller) admit(method string, bytes int64) error {
+	prio := c.priority(method)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	shed := false
+	switch {
+	case c.level >= LevelCritical && prio < High:
+		shed = true
+	case c.level >= LevelElevated && prio == Low:
+		shed = true
+	case float64(c.inFlight) >= c.limit*limitShare[prio]:
+		shed = true
+	}
+
+	if shed {
+		metrics.OverloadShed.WithLabelValues(method, prio.String()).Inc()
+		return status.Error(codes.ResourceExhausted, "server is overloaded, try again later")
+	}
+
+	c.inFlight++
+	c.inFlightBytes += bytes
+	metrics.OverloadInFlight.Set(float64(c.inFlight))
+	return nil
+}
+
+// done завершает вызов; latency > 0 учитывается в средней задержке
+func (c *Controller) done(bytes int64, latency time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.inFlight--
+	c.inFlightBytes -= bytes
+	if latency > 0 {
+		if c.latency == 0 {
+			c.latency = latency
+		} else {
+			// EWMA с коэффициентом 0.2
+			c.latency += (latency - c.latency) / 5
+		}
+	}
+	metrics.OverloadInFlight.Set(float64(c.inFlight))
+}
+
+func (c *Controller) addBytes(delta int64) {
+	c.mu.Lock()
+	c.inFlightBytes += delta
+	c.mu.Unlock()
+}
+
+// Stats - снимок состояния контроллера для отладочных ручек
+type Stats struct {
+	Level         string `json:"level"`
+	Limit         int    `json:"limit"`
+	InFlight      int    `json:"in_flight"`
+	InFlightBytes int64  `json:"in_flight_bytes"`
+	Latency       string `json:"latency"`
+}
+
+func (c *Controller) Stats() Stats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return Stats{
+		Level:         c.level.String(),
+		Limit:         int(c.limit),
+		InFlight:      c.inFlight,
+		InFlightBytes: c.inFlightBytes,
+		Latency:       c.latency.String(),
+	}
+}
@@ -0,0 +1,241 @@
+package ratelimiter
+
+import (
+	"Tages/internal/clientinfo"
+	"Tages/internal/metrics"
+	"context"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+// ByteBucket - бакет байтов: пополняется со скоростью rate байт/сек до burst.
+// Запас может уйти в минус, тогда следующий вызов ждет, пока долг не погасится,
+// так чанк больше burst тоже проходит, но с соответствующей паузой.
+type ByteBucket struct {
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+	mu     sync.Mutex
+}
+
+func NewByteBucket(bytesPerSec, burst int64) *ByteBucket {
+	if burst <= 0 {
+		burst = bytesPerSec
+	}
+	return &ByteBucket{
+		rate:   float64(bytesPerSec),
+		burst:  float64(burst),
+		tokens: float64(burst),
+		last:   time.Now(),
+	}
+}
+
+// Reserve списывает n байт и возвращает, сколько нужно подождать перед передачей
+func (b *ByteBucket) Reserve(n int) time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := time.Now()
+	b.tokens += now.Sub(b.last).Seconds() * b.rate
+	if b.tokens > b.burst {
+		b.tokens = b.burst
+	}
+	b.last = now
+
+	b.tokens -= float64(n)
+	if b.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-b.tokens / b.rate * float64(time.Second))
+}
+
+// Refund возвращает n байт, списанных Reserve, но так и не переданных
+func (b *ByteBucket) Refund(n int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.tokens += float64(n)
+	if b.tokens > b.burst {
+		b.tokens = b.burst
+	}
+}
+
+type BandwidthConfig struct {
+	// 0 - без ограничения
+	ClientBytesPerSec int64
+	ClientBurst       int64
+	GlobalBytesPerSec int64
+	GlobalBurst       int64
+}
+
+type byteBucketWrapper struct {
+	bucket   *ByteBucket
+	lastSeen time.Time
+}
+
+// Bandwidth ограничивает скорость передачи данных в стримах на клиента и в целом
+type Bandwidth struct {
+	cfg       BandwidthConfig
+	global    *ByteBucket
+	buckets   map[string]*byteBucketWrapper
+	bucketsMu sync.Mutex
+	ttl       time.Duration
+	keyFunc   clientinfo.KeyFunc
+	logger    *logrus.Logger
+	stopCh    chan struct{}
+}
+
+func NewBandwidth(cfg BandwidthConfig, keyFunc clientinfo.KeyFunc, logger *logrus.Logger) *Bandwidth {
+	if keyFunc == nil {
+		keyFunc = clientinfo.HostKey
+	}
+	bw := &Bandwidth{
+		cfg:     cfg,
+		buckets: make(map[string]*byteBucketWrapper),
+		ttl:     5 * time.Minute,
+		keyFunc: keyFunc,
+		logger:  logger,
+		stopCh:  make(chan struct{}),
+	}
+	if cfg.GlobalBytesPerSec > 0 {
+		bw.global = NewByteBucket(cfg.GlobalBytesPerSec, cfg.GlobalBurst)
+	}
+	go bw.cleanupLoop()
+	return bw
+}
+
+func (bw *Bandwidth) Stop() {
+	close(bw.stopCh)
+}
+
+func (bw *Bandwidth) cleanupLoop() {
+	ticker := time.NewTicker(1 * time.Minute)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-bw.stopCh:
+			return
+		case <-ticker.C:
+			now := time.Now()
+			bw.bucketsMu.Lock()
+			for key, wrapper := range bw.buckets {
+				if now.Sub(wrapper.lastSeen) > bw.ttl {
+					delete(bw.buckets, key)
+				}
+			}
+			bw.bucketsMu.Unlock()
+		}
+	}
+}
+
+func (bw *Bandwidth) clientBucket(key string) *ByteBucket {
+	if bw.cfg.ClientBytesPerSec <= 0 {
+		return nil
+	}
+
+	bw.bucketsMu.Lock()
+	defer bw.bucketsMu.Unlock()
+
+	wrapper, ok := bw.buckets[key]
+	if !ok {
+		wrapper = &byteBucketWrapper{bucket: NewByteBucket(bw.cfg.ClientBytesPerSec, bw.cfg.ClientBurst)}
+		bw.buckets[key] = wrapper
+	}
+	wrapper.lastSeen = time.Now()
+	return wrapper.bucket
+}
+
+// wait выдерживает паузу, нужную для передачи n байт в рамках обоих лимитов
+func (bw *Bandwidth) wait(ctx context.Context, client *ByteBucket, method, direction string, n int) error {
+	var delay time.Duration
+	if client != nil {
+		delay = client.Reserve(n)
+	}
+	if bw.global != nil {
+		if d := bw.global.Reserve(n); d > delay {
+			delay = d
+		}
+	}
+	if delay <= 0 {
+		return nil
+	}
+
+	// учитываем фактическое ожидание: отмененный стрим ждал меньше плана
+	start := time.Now()
+	defer func() {
+		metrics.BandwidthThrottledSeconds.WithLabelValues(method, direction).Add(time.Since(start).Seconds())
+	}()
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		// передача не состоится, резерв возвращаем, иначе долг отменённого
+		// стрима тормозит следующие вызовы клиента
+		if client != nil {
+			client.Refund(n)
+		}
+		if bw.global != nil {
+			bw.global.Refund(n)
+		}
+		return status.FromContextError(ctx.Err()).Err()
+	}
+}
+
+type throttledStream struct {
+	grpc.ServerStream
+	bw     *Bandwidth
+	client *ByteBucket
+	method string
+}
+
+func (s *throttledStream) SendMsg(m interface{}) error {
+	if err := s.bw.wait(s.Context(), s.client, s.method, "send", messageSize(m)); err != nil {
+		return err
+	}
+	return s.ServerStream.SendMsg(m)
+}
+
+// входящие чанки оплачиваем после получения: пауза перед следующим Recv
+// через flow control gRPC притормаживает отправителя
+func (s *throttledStream) RecvMsg(m interface{}) error {
+	if err := s.ServerStream.RecvMsg(m); err != nil {
+		return err
+	}
+	return s.bw.wait(s.Context(), s.client, s.method, "recv", messageSize(m))
+}
+
+func (bw *Bandwidth) StreamInterceptor() grpc.StreamServerInterceptor {
+	return func(
+		srv interface{},
+		ss grpc.ServerStream,
+		info *grpc.StreamServerInfo,
+		handler grpc.StreamHandler,
+	) error {
+		if bw.cfg.ClientBytesPerSec <= 0 && bw.global == nil {
+			return handler(srv, ss)
+		}
+
+		return handler(srv, &throttledStream{
+			ServerStream: ss,
+			bw:           bw,
+			client:       bw.clientBucket(bw.keyFunc(ss.Context())),
+			method:       info.FullMethod,
+		})
+	}
+}
+
+func messageSize(m interface{}) int {
+	if msg, ok := m.(proto.Message); ok {
+		return proto.Size(msg)
+	}
+	return 0
+}
@@ -0,0 +1,108 @@
+package ratelimiter
+
+import (
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/viper"
+)
+
+// Policy - размер бакета, скорость пополнения и цена одного вызова
+type Policy struct {
+	MaxTokens   int
+	RefillEvery time.Duration
+	Cost        int
+}
+
+func (p Policy) validate() error {
+	if p.MaxTokens <= 0 {
+		return errors.New("tokens must be positive")
+	}
+	if p.RefillEvery <= 0 {
+		return errors.New("interval_ms must be positive")
+	}
+	if p.Cost <= 0 || p.Cost > p.MaxTokens {
+		return errors.New("cost must be positive and not greater than tokens")
+	}
+	return nil
+}
+
+// Policies - политики по полному имени gRPC-метода и политика по умолчанию
+type Policies struct {
+	Default Policy
+	Methods map[string]Policy
+}
+
+// defaultPolicyKey - бакет, общий для всех методов без своей политики
+const defaultPolicyKey = "*"
+
+// For возвращает политику метода и имя бакета, к которому она относится
+func (p Policies) For(fullMethod string) (Policy, string) {
+	if policy, ok := p.Methods[fullMethod]; ok {
+		return policy, fullMethod
+	}
+	return p.Default, defaultPolicyKey
+}
+
+type policyConfig struct {
+	Method     string `mapstructure:"method"`
+	Tokens     int    `mapstructure:"tokens"`
+	IntervalMs int    `mapstructure:"interval_ms"`
+	Cost       int    `mapstructure:"cost"`
+}
+
+// LoadPolicies читает ratelimiter.tokens/interval_ms как политику по умолчанию
+// и список ratelimiter.policies:
+//
+//	ratelimiter:
+//	  policies:
+//	    - method: /tages.service.FileService/UploadFileStream
+//	      tokens: 20
+//	      interval_ms: 1000
+//	      cost: 10
+//
+// Не заданные в записи поля берутся из политики по умолчанию.
+func LoadPolicies(v *viper.Viper) (Policies, error) {
+	policies := Policies{
+		Default: Policy{
+			MaxTokens:   v.GetInt("ratelimiter.tokens"),
+			RefillEvery: time.Duration(v.GetInt("ratelimiter.interval_ms")) * time.Millisecond,
+			Cost:        1,
+		},
+		Methods: make(map[string]Policy),
+	}
+	if err := policies.Default.validate(); err != nil {
+		return Policies{}, errors.Wrap(err, "invalid default rate-limit policy")
+	}
+
+	var configs []policyConfig
+	if err := v.UnmarshalKey("ratelimiter.policies", &configs); err != nil {
+		return Policies{}, errors.Wrap(err, "cant parse ratelimiter.policies")
+	}
+
+	for _, c := range configs {
+		if c.Method == "" {
+			return Policies{}, errors.New("rate-limit policy without method")
+		}
+		if _, dup := policies.Methods[c.Method]; dup {
+			return Policies{}, errors.Errorf("duplicate rate-limit policy for %s", c.Method)
+		}
+
+		policy := policies.Default
+		if c.Tokens != 0 {
+			policy.MaxTokens = c.Tokens
+		}
+		if c.IntervalMs != 0 {
+			policy.RefillEvery = time.Duration(c.IntervalMs) * time.Millisecond
+		}
+		if c.Cost != 0 {
+			policy.Cost = c.Cost
+		}
+		if err := policy.validate(); err != nil {
+			return Policies{}, errors.Wrapf(err, "invalid rate-limit policy for %s", c.Method)
+		}
+		policies.Methods[c.Method] = policy
+	}
+
+	return policies, nil
+}
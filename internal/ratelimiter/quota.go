@@ -0,0 +1,48 @@
+package ratelimiter
+
+import (
+	"strconv"
+	"time"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+// заголовки ответа с состоянием квоты, время - в целых секундах с округлением вверх
+const (
+	HeaderLimit      = "x-ratelimit-limit"
+	HeaderRemaining  = "x-ratelimit-remaining"
+	HeaderReset      = "x-ratelimit-reset"
+	HeaderRetryAfter = "retry-after"
+)
+
+func quotaMetadata(res Result) metadata.MD {
+	md := metadata.Pairs(
+		HeaderLimit, strconv.Itoa(res.Limit),
+		HeaderRemaining, strconv.Itoa(res.Remaining),
+		HeaderReset, ceilSeconds(res.Reset),
+	)
+	if !res.Allowed {
+		md.Set(HeaderRetryAfter, ceilSeconds(res.RetryAfter))
+	}
+	return md
+}
+
+// rejectError - ResourceExhausted с RetryInfo, чтобы клиент знал, когда повторять
+func rejectError(res Result) error {
+	st := status.New(codes.ResourceExhausted, "too many requests")
+	withDetails, err := st.WithDetails(&errdetails.RetryInfo{
+		RetryDelay: durationpb.New(res.RetryAfter),
+	})
+	if err != nil {
+		return st.Err()
+	}
+	return withDetails.Err()
+}
+
+func ceilSeconds(d time.Duration) string {
+	return strconv.FormatInt(int64((d+time.Second-1)/time.Second), 10)
+}
@@ -1,15 +1,15 @@
 package ratelimiter
 
 import (
+	"Tages/internal/clientinfo"
+	"Tages/internal/metrics"
 	"context"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/sirupsen/logrus"
 	"google.golang.org/grpc"
-	"google.golang.org/grpc/codes"
-	"google.golang.org/grpc/peer"
-	"google.golang.org/grpc/status"
 )
 
 type TokenBucket struct {
@@ -29,62 +29,170 @@ func NewTokenBucket(maxTokens int, refillEvery time.Duration) *TokenBucket {
 	}
 }
 
+// Result - решение лимитера и состояние бакета после него
+type Result struct {
+	Allowed   bool
+	Limit     int
+	Remaining int
+	// через сколько бакет пополнится целиком
+	Reset time.Duration
+	// через сколько хватит токенов на отклоненный вызов
+	RetryAfter time.Duration
+}
+
+// newResult считает квоту по остатку токенов и времени с последнего пополнения
+func newResult(maxTokens, tokens, cost int, refillEvery, sinceRefill time.Duration, allowed bool) Result {
+	nextToken := refillEvery - sinceRefill
+	if nextToken < 0 {
+		nextToken = 0
+	}
+
+	res := Result{
+		Allowed:   allowed,
+		Limit:     maxTokens,
+		Remaining: tokens,
+	}
+	if tokens < maxTokens {
+		res.Reset = nextToken + time.Duration(maxTokens-tokens-1)*refillEvery
+	}
+	if !allowed {
+		res.RetryAfter = nextToken + time.Duration(cost-tokens-1)*refillEvery
+	}
+	return res
+}
+
+// Reconfigure меняет размер и скорость пополнения, не сбрасывая накопленный
+// расход: токены, набежавшие по старой скорости, зачисляются до переключения
+func (tb *TokenBucket) Reconfigure(maxTokens int, refillEvery time.Duration) {
+	tb.mu.Lock()
+	defer tb.mu.Unlock()
+
+	if tb.maxTokens == maxTokens && tb.refillEvery == refillEvery {
+		return
+	}
+	tb.refill(time.Now())
+	tb.maxTokens = maxTokens
+	tb.refillEvery = refillEvery
+	if tb.tokens > maxTokens {
+		tb.tokens = maxTokens
+	}
+}
+
 func (tb *TokenBucket) Allow() bool {
-	now := time.Now()
-	elapsed := now.Sub(tb.lastRefill)
+	return tb.AllowN(1)
+}
+
+// AllowN списывает n токенов, если их хватает
+func (tb *TokenBucket) AllowN(n int) bool {
+	return tb.TakeN(n).Allowed
+}
 
+// TakeN как AllowN, но возвращает еще и остаток квоты
+func (tb *TokenBucket) TakeN(n int) Result {
 	tb.mu.Lock()
 	defer tb.mu.Unlock()
 
-	newTokens := int(elapsed / tb.refillEvery)
+	now := time.Now()
+	tb.refill(now)
+
+	allowed := tb.tokens >= n
+	if allowed {
+		tb.tokens -= n
+	}
+	return newResult(tb.maxTokens, tb.tokens, n, tb.refillEvery, now.Sub(tb.lastRefill), allowed)
+}
+
+func (tb *TokenBucket) refill(now time.Time) {
+	newTokens := int(now.Sub(tb.lastRefill) / tb.refillEvery)
 	if newTokens > 0 {
 		tb.tokens += newTokens
-		if tb.tokens > tb.maxTokens {
+		// сохраняем остаток интервала, иначе частые запросы тормозят пополнение
+		tb.lastRefill = tb.lastRefill.Add(time.Duration(newTokens) * tb.refillEvery)
+		if tb.tokens >= tb.maxTokens {
 			tb.tokens = tb.maxTokens
+			tb.lastRefill = now
 		}
-		tb.lastRefill = now
 	}
-
-	if tb.tokens > 0 {
-		tb.tokens--
-		return true
-	}
-	return false
 }
 
 type bucketWrapper struct {
-	bucket   *TokenBucket
-	lastSeen time.Time
+	bucket *TokenBucket
+	// имя политики, по которой создан бакет: метод или "*"
+	policyKey string
+	lastSeen  time.Time
 }
 
 type RateLimiter struct {
 	buckets   map[string]*bucketWrapper
 	bucketsMu sync.RWMutex
-	maxTokens int
-	interval  time.Duration
+	policies  atomic.Pointer[Policies]
 	ttl       time.Duration
+	keyFunc   clientinfo.KeyFunc
 	logger    *logrus.Logger
 	stopCh    chan struct{}
+
+	backend Backend
+	// после ошибки backend не опрашивается до этого момента
+	backendDownUntil atomic.Int64
+	backendRetry     time.Duration
 }
 
-func New(maxTokens int, interval time.Duration, logger *logrus.Logger) *RateLimiter {
+// backend - общее для реплик хранилище, nil - только локальные бакеты.
+// keyFunc определяет, по какому ключу клиенты делят бакет, nil - по IP без порта
+func New(policies Policies, backend Backend, keyFunc clientinfo.KeyFunc, logger *logrus.Logger) *RateLimiter {
+	if keyFunc == nil {
+		keyFunc = clientinfo.HostKey
+	}
 	rl := &RateLimiter{
-		buckets:   make(map[string]*bucketWrapper),
-		maxTokens: maxTokens,
-		interval:  interval,
-		ttl:       5 * time.Minute,
-		logger:    logger,
-		stopCh:    make(chan struct{}),
+		buckets:      make(map[string]*bucketWrapper),
+		ttl:          5 * time.Minute,
+		keyFunc:      keyFunc,
+		logger:       logger,
+		stopCh:       make(chan struct{}),
+		backend:      backend,
+		backendRetry: 5 * time.Second,
 	}
+	rl.policies.Store(&policies)
 	go rl.cleanupLoop()
 	return rl
 }
 
+// Policies - действующие политики
+func (rl *RateLimiter) Policies() Policies {
+	return *rl.policies.Load()
+}
+
+// SetPolicies применяет новые политики. Локальные бакеты сохраняются, у них
+// меняются размер и скорость пополнения, иначе перезагрузка конфига выдавала
+// бы каждому клиенту полный бакет. Бакеты метода, у которого политику убрали,
+// больше не используются и уходят по ttl.
+func (rl *RateLimiter) SetPolicies(policies Policies) {
+	rl.policies.Store(&policies)
+
+	rl.bucketsMu.RLock()
+	defer rl.bucketsMu.RUnlock()
+	for _, wrapper := range rl.buckets {
+		policy, ok := policies.Methods[wrapper.policyKey]
+		if wrapper.policyKey == defaultPolicyKey {
+			policy, ok = policies.Default, true
+		}
+		if ok {
+			wrapper.bucket.Reconfigure(policy.MaxTokens, policy.RefillEvery)
+		}
+	}
+}
+
 func (rl *RateLimiter) Stop() {
 	close(rl.stopCh)
 	rl.bucketsMu.Lock()
 	rl.buckets = make(map[string]*bucketWrapper)
 	rl.bucketsMu.Unlock()
+
+	if rl.backend != nil {
+		if err := rl.backend.Close(); err != nil {
+			rl.logger.WithError(err).Warn("Failed to close rate-limit backend")
+		}
+	}
 }
 
 func (rl *RateLimiter) cleanupLoop() {
@@ -98,17 +206,17 @@ func (rl *RateLimiter) cleanupLoop() {
 			now := time.Now()
 			rl.bucketsMu.RLock()
 			toDelete := []string{}
-			for ip, wrapper := range rl.buckets {
+			for key, wrapper := range rl.buckets {
 				if now.Sub(wrapper.lastSeen) > rl.ttl {
-					toDelete = append(toDelete, ip)
+					toDelete = append(toDelete, key)
 				}
 			}
 			rl.bucketsMu.RUnlock()
 
 			if len(toDelete) > 0 {
 				rl.bucketsMu.Lock()
-				for _, ip := range toDelete {
-					delete(rl.buckets, ip)
+				for _, key := range toDelete {
+					delete(rl.buckets, key)
 				}
 				rl.bucketsMu.Unlock()
 			}
@@ -116,28 +224,56 @@ func (rl *RateLimiter) cleanupLoop() {
 	}
 }
 
-func (rl *RateLimiter) allowRequest(ip string) error {
+func (rl *RateLimiter) allowRequest(ctx context.Context, method, client string) (Result, error) {
+	policy, bucketName := rl.policies.Load().For(method)
+	key := bucketName + "|" + client
+
+	res := rl.take(ctx, key, bucketName, policy)
+	if !res.Allowed {
+		rl.logger.Infof("Rate limit exceeded for client: %s", key)
+		return res, rejectError(res)
+	}
+
+	return res, nil
+}
+
+// take идет в общий backend, а если он недоступен - в локальный бакет
+func (rl *RateLimiter) take(ctx context.Context, key, policyKey string, policy Policy) Result {
+	if rl.backend != nil && time.Now().UnixNano() >= rl.backendDownUntil.Load() {
+		res, err := rl.backend.Take(ctx, key, policy)
+		if err == nil {
+			return res
+		}
+
+		rl.backendDownUntil.Store(time.Now().Add(rl.backendRetry).UnixNano())
+		metrics.RateLimitBackendFallback.Inc()
+		rl.logger.WithError(err).Warnf("Rate-limit backend unavailable, using local buckets for %s", rl.backendRetry)
+	}
+
+	return rl.takeLocal(key, policyKey, policy)
+}
+
+func (rl *RateLimiter) takeLocal(key, policyKey string, policy Policy) Result {
 	rl.bucketsMu.RLock()
-	wrapper, exists := rl.buckets[ip]
+	wrapper, exists := rl.buckets[key]
 	rl.bucketsMu.RUnlock()
 
 	if !exists {
-		bucket := NewTokenBucket(rl.maxTokens, rl.interval)
-		wrapper = &bucketWrapper{bucket: bucket, lastSeen: time.Now()}
 		rl.bucketsMu.Lock()
-		rl.buckets[ip] = wrapper
+		// бакет мог создать параллельный запрос того же клиента
+		wrapper, exists = rl.buckets[key]
+		if !exists {
+			bucket := NewTokenBucket(policy.MaxTokens, policy.RefillEvery)
+			wrapper = &bucketWrapper{bucket: bucket, policyKey: policyKey, lastSeen: time.Now()}
+			rl.buckets[key] = wrapper
+			rl.logger.Infof("Created new bucket for client: %s", key)
+		}
 		rl.bucketsMu.Unlock()
-		rl.logger.Infof("Created new bucket for IP: %s", ip)
 	}
 
 	wrapper.lastSeen = time.Now()
 
-	if !wrapper.bucket.Allow() {
-		rl.logger.Infof("Rate limit exceeded for IP: %s", ip)
-		return status.Errorf(codes.ResourceExhausted, "too many requests")
-	}
-
-	return nil
+	return wrapper.bucket.TakeN(policy.Cost)
 }
 
 func (rl *RateLimiter) UnaryInterceptor() grpc.UnaryServerInterceptor {
@@ -147,13 +283,10 @@ func (rl *RateLimiter) UnaryInterceptor() grpc.UnaryServerInterceptor {
 		info *grpc.UnaryServerInfo,
 		handler grpc.UnaryHandler,
 	) (interface{}, error) {
-		p, _ := peer.FromContext(ctx)
-		ip := "unknown"
-		if p != nil && p.Addr != nil {
-			ip = p.Addr.String()
-		}
-
-		if err := rl.allowRequest(ip); err != nil {
+		res, err := rl.allowRequest(ctx, info.FullMethod, rl.keyFunc(ctx))
+		// вне настоящего gRPC-вызова (в тестах) заголовки ставить некуда
+		_ = grpc.SetHeader(ctx, quotaMetadata(res))
+		if err != nil {
 			return nil, err
 		}
 
@@ -168,16 +301,41 @@ func (rl *RateLimiter) StreamInterceptor() grpc.StreamServerInterceptor {
 		info *grpc.StreamServerInfo,
 		handler grpc.StreamHandler,
 	) error {
-		p, _ := peer.FromContext(ss.Context())
-		ip := "unknown"
-		if p != nil && p.Addr != nil {
-			ip = p.Addr.String()
-		}
-
-		if err := rl.allowRequest(ip); err != nil {
+		res, err := rl.allowRequest(ss.Context(), info.FullMethod, rl.keyFunc(ss.Context()))
+		_ = ss.SetHeader(quotaMetadata(res))
+		if err != nil {
 			return err
 		}
 
 		return handler(srv, ss)
 	}
 }
+
+// Stats - снимок состояния лимитера для отладочных ручек
+type Stats struct {
+	// локальных бакетов клиентов
+	Buckets int `json:"buckets"`
+	// общий backend настроен и сейчас используется
+	Backend     bool       `json:"backend"`
+	BackendDown bool       `json:"backend_down"`
+	Policies    Policies   `json:"policies"`
+	DownUntil   *time.Time `json:"backend_down_until,omitempty"`
+}
+
+func (rl *RateLimiter) Stats() Stats {
+	rl.bucketsMu.RLock()
+	buckets := len(rl.buckets)
+	rl.bucketsMu.RUnlock()
+
+	stats := Stats{
+		Buckets:  buckets,
+		Backend:  rl.backend != nil,
+		Policies: *rl.policies.Load(),
+	}
+	if until := rl.backendDownUntil.Load(); rl.backend != nil && time.Now().UnixNano() < until {
+		stats.BackendDown = true
+		downUntil := time.Unix(0, until).UTC()
+		stats.DownUntil = &downUntil
+	}
+	return stats
+}
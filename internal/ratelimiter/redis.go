@@ -0,0 +1,117 @@
+package ratelimiter
+
+import (
+	"context"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/redis/go-redis/v9"
+)
+
+// Backend - общее для реплик хранилище бакетов
+type Backend interface {
+	// Take списывает policy.Cost токенов из бакета key
+	Take(ctx context.Context, key string, policy Policy) (Result, error)
+	Close() error
+}
+
+// тот же алгоритм, что и TokenBucket.AllowN, но атомарно на стороне redis.
+// Время берется у redis: часы реплик могут расходиться, а бакет у них общий.
+var takeScript = redis.NewScript(`
+local max_tokens = tonumber(ARGV[1])
+local refill_ms = tonumber(ARGV[2])
+local cost = tonumber(ARGV[3])
+local ttl_ms = tonumber(ARGV[4])
+
+local clock = redis.call('TIME')
+local now = tonumber(clock[1]) * 1000 + math.floor(tonumber(clock[2]) / 1000)
+
+local state = redis.call('HMGET', KEYS[1], 'tokens', 'ts')
+local tokens = tonumber(state[1])
+local ts = tonumber(state[2])
+if tokens == nil or ts == nil then
+	tokens = max_tokens
+	ts = now
+end
+
+local refill = math.floor((now - ts) / refill_ms)
+if refill > 0 then
+	tokens = tokens + refill
+	ts = ts + refill * refill_ms
+	if tokens >= max_tokens then
+		tokens = max_tokens
+		ts = now
+	end
+end
+
+local allowed = 0
+if tokens >= cost then
+	tokens = tokens - cost
+	allowed = 1
+end
+
+redis.call('HSET', KEYS[1], 'tokens', tokens, 'ts', ts)
+redis.call('PEXPIRE', KEYS[1], ttl_ms)
+return {allowed, tokens, now - ts}
+`)
+
+type RedisConfig struct {
+	Addr      string
+	Password  string
+	DB        int
+	KeyPrefix string
+	// таймаут одной операции, после него запрос обслуживается локальным бакетом
+	Timeout time.Duration
+}
+
+type RedisBackend struct {
+	client  *redis.Client
+	prefix  string
+	timeout time.Duration
+}
+
+func NewRedisBackend(cfg RedisConfig) *RedisBackend {
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = 50 * time.Millisecond
+	}
+	return &RedisBackend{
+		client: redis.NewClient(&redis.Options{
+			Addr:         cfg.Addr,
+			Password:     cfg.Password,
+			DB:           cfg.DB,
+			DialTimeout:  cfg.Timeout,
+			ReadTimeout:  cfg.Timeout,
+			WriteTimeout: cfg.Timeout,
+			MaxRetries:   -1,
+		}),
+		prefix:  cfg.KeyPrefix,
+		timeout: cfg.Timeout,
+	}
+}
+
+func (b *RedisBackend) Take(ctx context.Context, key string, policy Policy) (Result, error) {
+	ctx, cancel := context.WithTimeout(ctx, b.timeout)
+	defer cancel()
+
+	// бакет живет, пока не пополнится целиком
+	ttl := time.Duration(policy.MaxTokens) * policy.RefillEvery
+	res, err := takeScript.Run(ctx, b.client, []string{b.prefix + key},
+		policy.MaxTokens,
+		policy.RefillEvery.Milliseconds(),
+		policy.Cost,
+		ttl.Milliseconds(),
+	).Int64Slice()
+	if err != nil {
+		return Result{}, errors.Wrap(err, "redis rate-limit script failed")
+	}
+	if len(res) != 3 {
+		return Result{}, errors.Errorf("unexpected redis rate-limit reply %v", res)
+	}
+
+	sinceRefill := time.Duration(res[2]) * time.Millisecond
+	return newResult(policy.MaxTokens, int(res[1]), policy.Cost, policy.RefillEvery, sinceRefill, res[0] == 1), nil
+}
+
+func (b *RedisBackend) Close() error {
+	return b.client.Close()
+}
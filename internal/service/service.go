@@ -1,65 +1,149 @@
 package service
 
 import (
+	"Tages/internal/accesslog"
+	"Tages/internal/admission"
+	"Tages/internal/audit"
 	"Tages/internal/cache"
+	"Tages/internal/clientinfo"
+	"Tages/internal/coalesce"
+	"Tages/internal/drain"
 	"Tages/internal/dto"
 	"Tages/internal/helper"
 	"Tages/internal/storage"
+	"Tages/internal/tracing"
 	pb "Tages/pkg"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"io"
 	"os"
 	"path/filepath"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/google/uuid"
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/viper"
+	"go.opentelemetry.io/otel/attribute"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
 	"google.golang.org/protobuf/types/known/timestamppb"
 )
 
-const maxFileSize = 100 * 1024 * 1024
+const (
+	maxFileSize       = 100 * 1024 * 1024
+	downloadChunkSize = 64 * 1024
+)
+
+var errFileTooLarge = status.Error(codes.InvalidArgument, "file exceeds maximum allowed size")
 
 type ServiceFile struct {
 	pb.UnimplementedFileServiceServer
 	uploadDir   string
 	cache       cache.CacheInterface
+	content     *cache.ContentCache
 	logger      *logrus.Logger
 	storage     storage.StorageInterface
-	uploadCh    chan struct{}
+	admission   *admission.Controller
+	transfers   *drain.Tracker
+	clientKey   clientinfo.KeyFunc
 	listFilesCh chan struct{}
+	maxFileSize atomic.Int64
 	mu          sync.Mutex
+	// одновременные промахи кеша и чтения одного файла идут в источник один раз
+	lists      *coalesce.Group[[]dto.File]
+	lookups    *coalesce.Group[dto.File]
+	reads      *coalesce.Group[[]byte]
+	sharedRead int64
 }
 
-func NewServicefile(ctx context.Context, logger *logrus.Logger, cache cache.CacheInterface, storage storage.StorageInterface) (*ServiceFile, error) {
+func NewServicefile(ctx context.Context, logger *logrus.Logger, metaCache cache.CacheInterface, storage storage.StorageInterface) (*ServiceFile, error) {
 	dir := viper.GetString("upload.dir")
 	if !ensureDir(logger, dir) {
 		return nil, nil
 	}
 
-	return &ServiceFile{
-		uploadCh:    make(chan struct{}, 10),
+	uploads, downloads, err := admission.LoadConfig(viper.GetViper())
+	if err != nil {
+		return nil, err
+	}
+	clientKey, err := clientinfo.FromConfig(viper.GetViper())
+	if err != nil {
+		return nil, err
+	}
+	contentLimits, err := cache.LoadContentLimits(viper.GetViper())
+	if err != nil {
+		return nil, err
+	}
+	resultTTL := time.Duration(viper.GetInt64("coalesce.result_ttl_ms")) * time.Millisecond
+
+	srv := &ServiceFile{
+		admission:   admission.New(uploads, downloads),
+		transfers:   drain.New(logger),
+		clientKey:   clientKey,
 		listFilesCh: make(chan struct{}, 100),
 		uploadDir:   dir,
-		cache:       cache,
+		lists:       coalesce.New[[]dto.File]("list_files", resultTTL),
+		lookups:     coalesce.New[dto.File]("file_lookup", resultTTL),
+		reads:       coalesce.New[[]byte]("file_read", 0),
+		sharedRead:  viper.GetInt64("coalesce.download_max_bytes"),
+		cache:       metaCache,
+		content:     cache.NewContentCache(contentLimits),
 		logger:      logger,
 		storage:     storage,
-	}, nil
+	}
+	srv.SetMaxFileSize(viper.GetInt64("upload.max_file_size"))
+
+	return srv, nil
+}
+
+// SetMaxFileSize меняет предельный размер загружаемого файла, 0 - значение по умолчанию
+func (s *ServiceFile) SetMaxFileSize(size int64) {
+	if size <= 0 {
+		size = maxFileSize
+	}
+	s.maxFileSize.Store(size)
+}
+
+// Transfers - учет идущих передач для остановки сервера
+func (s *ServiceFile) Transfers() *drain.Tracker {
+	return s.transfers
+}
+
+// ContentStats - состояние кеша содержимого файлов
+func (s *ServiceFile) ContentStats() cache.ContentStats {
+	return s.content.Stats()
+}
+
+// SetContentLimits меняет бюджет кеша содержимого файлов
+func (s *ServiceFile) SetContentLimits(limits cache.ContentLimits) {
+	s.content.SetLimits(limits)
 }
 
 // получение файла, запись на диск
 func (s *ServiceFile) UploadFileUnary(ctx context.Context, req *pb.UploadRequest) (*pb.UploadResponse, error) {
-	s.uploadCh <- struct{}{}
-	s.logger.WithField("свободных слотов в семафоре", cap(s.uploadCh)-len(s.uploadCh)).Info("состояние семафора")
-	defer func() {
-		<-s.uploadCh
-	}()
+	op, ctx, err := s.transfers.Begin(ctx, "upload")
+	if err != nil {
+		return nil, err
+	}
+	defer op.Done()
+
+	release, err := s.admission.Uploads.Acquire(ctx, s.clientKey(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	if int64(len(req.Data)) > s.maxFileSize.Load() {
+		return nil, errFileTooLarge
+	}
 
 	filename := filepath.Base(req.Filename)
 	if filename == "" {
-		s.logger.Warn("UploadFileUnary: filename is empty, using 'unknown'")
+		s.log(ctx).Warn("Filename is empty, using 'unknow'")
 		filename = "unknow"
 	}
 	uniqueName := helper.UniqueFilename(filename)
@@ -67,38 +151,51 @@ func (s *ServiceFile) UploadFileUnary(ctx context.Context, req *pb.UploadRequest
 
 	file, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
 	if err != nil {
-		s.logger.WithError(err).WithField("file", file).Error("cant create file")
+		s.log(ctx).WithError(err).WithField("file", path).Error("Cannot create file")
 		return nil, status.Errorf(codes.Internal, "failed to save file")
 	}
+	op.Track(path)
 
 	defer file.Close()
 
-	if _, err := file.Write(req.Data); err != nil {
-		_ = os.Remove(path)
-		s.logger.WithError(err).WithField("file", file).Error("failed to write file ")
+	_, write := startTransfer(ctx, "file.write", "UploadFileUnary", uniqueName)
+	n, err := file.Write(req.Data)
+	write.chunk(n)
+	if err != nil {
+		write.end(err)
+		s.log(ctx).WithError(err).WithField("file", path).Error("Failed to write file")
 		return nil, status.Errorf(codes.Internal, "failed to save file")
 	}
 
+	sum := sha256.Sum256(req.Data)
 	f := dto.File{
+		ID:        uuid.New(),
 		Name:      uniqueName,
 		Path:      path,
+		Size:      int64(len(req.Data)),
+		Checksum:  hex.EncodeToString(sum[:]),
 		CreatedAt: time.Now().UTC(),
 		UpdatedAt: time.Now().UTC(),
 	}
 
 	if err := s.storage.WithInTransaction(ctx, func(txCtx context.Context) error {
 		if err := s.storage.AddFile(txCtx, f); err != nil {
-			s.logger.WithError(err).Errorf("cant add file %v to database", f)
+			s.log(txCtx).WithError(err).WithField("file", f.Name).Error("Cannot add file to database")
 			return err
 		}
-		s.logger.Infof("File %s added to DB", f.Name)
+		s.log(txCtx).WithField("file", f.Name).Info("File added to database")
 		return nil
 	}); err != nil {
-		s.logger.WithError(err).Error("transaction failed")
+		write.end(err)
+		s.log(ctx).WithError(err).Error("Transaction failed")
 		return nil, status.Errorf(codes.Internal, "failed to save file")
 	}
+	op.Commit()
+	// загрузка учитывается как успешная только после коммита
+	write.end(nil)
 
-	s.cache.Set(f)
+	s.remember(f)
+	audit.Annotate(ctx, uniqueName, int64(len(req.Data)))
 
 	// добавить имя файла, если анноу, юзер будет знать где сохранен его файл
 	return &pb.UploadResponse{
@@ -109,41 +206,65 @@ func (s *ServiceFile) UploadFileUnary(ctx context.Context, req *pb.UploadRequest
 }
 
 // загрузка файла стрим
-func (s *ServiceFile) UploadFileStream(stream pb.FileService_UploadFileStreamServer) error {
-	s.uploadCh <- struct{}{}
-	defer func() { <-s.uploadCh }()
+func (s *ServiceFile) UploadFileStream(stream pb.FileService_UploadFileStreamServer) (err error) {
+	op, ctx, err := s.transfers.Begin(stream.Context(), "upload")
+	if err != nil {
+		return err
+	}
+	// недописанный файл удаляется при любом выходе без Commit
+	defer op.Done()
+
+	release, err := s.admission.Uploads.Acquire(ctx, s.clientKey(ctx))
+	if err != nil {
+		return err
+	}
+	defer release()
 
 	var filename string
 	var file *os.File
+	var written int64
+	hash := sha256.New()
 	defer func() {
 		if file != nil {
 			file.Close()
 		}
 	}()
+	_, write := startTransfer(ctx, "file.write", "UploadFileStream", "")
+	defer func() { write.end(err) }()
 
 	for {
+		if err := ctx.Err(); err != nil {
+			return status.FromContextError(err).Err()
+		}
+
 		req, err := stream.Recv()
 		if err == io.EOF {
+			// итог записи фиксирует defer: успех только после коммита и ответа
 			savedFile := dto.File{
+				ID:        uuid.New(),
 				Name:      filename,
 				Path:      filepath.Join(s.uploadDir, filename),
+				Size:      written,
+				Checksum:  hex.EncodeToString(hash.Sum(nil)),
 				CreatedAt: time.Now().UTC(),
 				UpdatedAt: time.Now().UTC(),
 			}
 
-			if err := s.storage.WithInTransaction(stream.Context(), func(txCtx context.Context) error {
+			if err := s.storage.WithInTransaction(ctx, func(txCtx context.Context) error {
 				if err := s.storage.AddFile(txCtx, savedFile); err != nil {
-					s.logger.WithError(err).Errorf("cant add file %v to database", savedFile)
+					s.log(txCtx).WithError(err).WithField("file", savedFile.Name).Error("Cannot add file to database")
 					return err
 				}
-				s.logger.Infof("File %s added to DB", savedFile.Name)
+				s.log(txCtx).WithField("file", savedFile.Name).Info("File added to database")
 				return nil
 			}); err != nil {
-				s.logger.WithError(err).Error("transaction failed")
+				s.log(ctx).WithError(err).Error("Transaction failed")
 				return status.Errorf(codes.Internal, "failed to save file")
 			}
+			op.Commit()
 
-			s.cache.Set(savedFile)
+			s.remember(savedFile)
+			audit.Annotate(stream.Context(), filename, 0)
 
 			return stream.SendAndClose(&pb.UploadResponse{
 				Status: true,
@@ -166,22 +287,39 @@ func (s *ServiceFile) UploadFileStream(stream pb.FileService_UploadFileStreamSer
 			if err != nil {
 				return status.Errorf(codes.Internal, "failed to save file")
 			}
+			op.Track(path)
 			filename = uniqueName
+			write.setFile(uniqueName)
 		}
 
-		if _, err := file.Write(req.GetData()); err != nil {
+		if written+int64(len(req.GetData())) > s.maxFileSize.Load() {
+			return errFileTooLarge
+		}
+
+		n, err := file.Write(req.GetData())
+		written += int64(n)
+		hash.Write(req.GetData()[:n])
+		write.chunk(n)
+		audit.Annotate(stream.Context(), "", int64(n))
+		if err != nil {
 			return status.Errorf(codes.Internal, "failed to save file")
 		}
 	}
 }
 
 // загрузка файлов
-func (s *ServiceFile) DownloadFileStream(req *pb.DownloadRequest, stream pb.FileService_DownloadFileStreamServer) error {
-	s.uploadCh <- struct{}{}
-	s.logger.WithField("свободных слотов в семафоре", cap(s.uploadCh)-len(s.uploadCh)).Info("состояние семафора")
-	defer func() {
-		<-s.uploadCh
-	}()
+func (s *ServiceFile) DownloadFileStream(req *pb.DownloadRequest, stream pb.FileService_DownloadFileStreamServer) (err error) {
+	op, ctx, err := s.transfers.Begin(stream.Context(), "download")
+	if err != nil {
+		return err
+	}
+	defer op.Done()
+
+	release, err := s.admission.Downloads.Acquire(ctx, s.clientKey(ctx))
+	if err != nil {
+		return err
+	}
+	defer release()
 
 	filename := req.GetFilename()
 	if filename == "" {
@@ -190,6 +328,37 @@ func (s *ServiceFile) DownloadFileStream(req *pb.DownloadRequest, stream pb.File
 
 	path := filepath.Join(s.uploadDir, filename)
 
+	ctx, read := startTransfer(ctx, "file.read", "DownloadFileStream", filename)
+	defer func() { read.end(err) }()
+
+	data, ok, err := s.cachedContent(ctx, filename, path)
+	if err != nil {
+		return err
+	}
+	if ok {
+		audit.Annotate(stream.Context(), filename, 0)
+		return sendChunks(ctx, stream, data, read)
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return status.Error(codes.NotFound, "file not found")
+		}
+		return status.Errorf(codes.Internal, "failed to save file")
+	}
+	audit.Annotate(stream.Context(), filename, 0)
+
+	// небольшой файл читаем один раз на всех, кто качает его одновременно,
+	// свой дескриптор ему не нужен
+	if info.Size() <= s.sharedRead {
+		data, err := s.readShared(ctx, path)
+		if err != nil {
+			return err
+		}
+		return sendChunks(ctx, stream, data, read)
+	}
+
 	file, err := os.Open(path)
 	if err != nil {
 		if os.IsNotExist(err) {
@@ -199,8 +368,12 @@ func (s *ServiceFile) DownloadFileStream(req *pb.DownloadRequest, stream pb.File
 	}
 	defer file.Close()
 
-	buf := make([]byte, 64*1024)
+	buf := make([]byte, downloadChunkSize)
 	for {
+		if err := ctx.Err(); err != nil {
+			return status.FromContextError(err).Err()
+		}
+
 		n, err := file.Read(buf)
 		if err != nil && err != io.EOF {
 			return status.Errorf(codes.Internal, "failed to save file")
@@ -216,16 +389,24 @@ func (s *ServiceFile) DownloadFileStream(req *pb.DownloadRequest, stream pb.File
 		if err := stream.Send(resp); err != nil {
 			return status.Errorf(codes.Internal, "failed to save file")
 		}
+		read.chunk(n)
+		audit.Annotate(stream.Context(), "", int64(n))
 	}
 	return nil
 }
 
 func (s *ServiceFile) DownloadFileUnary(ctx context.Context, req *pb.DownloadRequest) (*pb.DownloadResponse, error) {
-	s.uploadCh <- struct{}{}
-	s.logger.WithField("свободных слотов в семафоре", cap(s.uploadCh)-len(s.uploadCh)).Info("состояние семафора")
-	defer func() {
-		<-s.uploadCh
-	}()
+	op, ctx, err := s.transfers.Begin(ctx, "download")
+	if err != nil {
+		return nil, err
+	}
+	defer op.Done()
+
+	release, err := s.admission.Downloads.Acquire(ctx, s.clientKey(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer release()
 
 	filename := req.Filename
 	if filename == "" {
@@ -234,21 +415,23 @@ func (s *ServiceFile) DownloadFileUnary(ctx context.Context, req *pb.DownloadReq
 
 	path := filepath.Join(s.uploadDir, filename)
 
-	file, err := os.Open(path)
-	if err != nil {
-		if os.IsNotExist(err) {
-			return nil, status.Error(codes.NotFound, "file not found")
-		}
-		s.logger.WithError(err).WithField("path", path).Error("cannot open file")
-		return nil, status.Error(codes.Internal, "failed to download file")
-	}
-	defer file.Close()
+	ctx, read := startTransfer(ctx, "file.read", "DownloadFileUnary", filename)
 
-	data, err := os.ReadFile(path)
+	data, ok, err := s.cachedContent(ctx, filename, path)
 	if err != nil {
-		s.logger.WithError(err).WithField("file", path).Error("cannot read file")
-		return nil, status.Error(codes.Internal, "failed to download file")
+		read.end(err)
+		return nil, err
+	}
+	if !ok {
+		data, err = s.readShared(ctx, path)
+		if err != nil {
+			read.end(err)
+			return nil, err
+		}
 	}
+	read.chunk(len(data))
+	read.end(nil)
+	audit.Annotate(ctx, filename, int64(len(data)))
 
 	return &pb.DownloadResponse{
 		Data: data,
@@ -262,13 +445,19 @@ func (s *ServiceFile) ListFiles(ctx context.Context, req *pb.ListRequest) (*pb.L
 		<-s.listFilesCh
 	}()
 
-	files := s.cache.GetFilesFromCache()
-	if files == nil {
+	_, span := tracing.Start(ctx, "cache.List")
+	files, ok := s.cache.List(cache.Filter{})
+	span.SetAttributes(attribute.Bool("cache.hit", ok))
+	span.End()
+	if !ok {
 		var err error
-		files, err = s.storage.GetAllFiles(ctx)
+		files, err = s.lists.Do(ctx, "all", s.storage.GetAllFiles)
 		if err != nil {
 			return nil, err
 		}
+		// кеш неполный после вытеснения или истечения ttl, заполняем заново;
+		// список больше границ кеша Warm не кладет и ничего не вытесняет
+		s.cache.Warm(files)
 	}
 
 	resp := &pb.ListResponse{}
@@ -284,21 +473,169 @@ func (s *ServiceFile) ListFiles(ctx context.Context, req *pb.ListRequest) (*pb.L
 	return resp, nil
 }
 
+// ApplyFileEvent применяет к кешам изменение файла с другой реплики
+func (s *ServiceFile) ApplyFileEvent(ctx context.Context, ev storage.FileEvent) {
+	s.forget(ev.Name)
+	s.content.Invalidate(ev.ID)
+
+	if ev.Op == storage.FileEventDelete {
+		s.cache.Delete(ev.Name)
+		return
+	}
+
+	f, err := s.storage.GetFileByName(ctx, ev.Name)
+	if err != nil {
+		// без свежих метаданных старую запись оставлять нельзя
+		s.cache.Delete(ev.Name)
+		if !errors.Is(err, storage.ErrNotFound) {
+			s.log(ctx).WithError(err).WithField("file", ev.Name).Warn("Cannot load changed file")
+		}
+		return
+	}
+	s.cache.Set(f)
+}
+
+// Resync заново заполняет кеши после пропущенных событий. Warm только
+// дописывает, поэтому кеш сначала сбрасывается, иначе удаленные за это время
+// файлы остались бы в списке.
+func (s *ServiceFile) Resync(ctx context.Context) error {
+	s.cache.Invalidate()
+	s.lists.Forget("all")
+	s.content.Purge()
+	return s.HeatCache(ctx)
+}
+
 // прогрев кеша при старте
 func (s *ServiceFile) HeatCache(ctx context.Context) error {
-	s.logger.Info("starting to fill the cache")
+	s.log(ctx).Info("Warming up cache")
 
 	files, err := s.storage.GetAllFiles(ctx)
-	if err != nil {
-		s.logger.Error("error in heat cache")
+	if err != nil && !errors.Is(err, storage.ErrNotFound) {
+		s.log(ctx).WithError(err).Error("Failed to warm up cache")
 		return err
 	}
 
+	// пустая таблица - тоже прогретый кеш
 	s.cache.Warm(files)
-	s.logger.Info("cache is full")
+	s.log(ctx).WithField("files", len(files)).Info("Cache warmed up")
 	return nil
 }
 
+// log - логгер текущего запроса, вне запроса - логгер сервиса
+func (s *ServiceFile) log(ctx context.Context) *logrus.Entry {
+	return accesslog.FromContextOr(ctx, s.logger)
+}
+
+// remember кладет метаданные в кеш и сбрасывает старое содержимое файла
+func (s *ServiceFile) remember(f dto.File) {
+	s.forget(f.Name)
+	s.content.Invalidate(f.ID)
+	s.cache.Set(f)
+}
+
+// forget сбрасывает общие результаты запросов, в которых мог быть файл
+func (s *ServiceFile) forget(name string) {
+	s.lists.Forget("all")
+	s.lookups.Forget(name)
+}
+
+// lookupFile ищет метаданные файла сначала в кеше, затем в БД
+func (s *ServiceFile) lookupFile(ctx context.Context, name string) (dto.File, error) {
+	_, span := tracing.Start(ctx, "cache.Get", tracing.AttrFileName.String(name))
+	f, ok := s.cache.Get(name)
+	span.SetAttributes(attribute.Bool("cache.hit", ok))
+	span.End()
+	if ok {
+		return f, nil
+	}
+
+	f, err := s.lookups.Do(ctx, name, func(ctx context.Context) (dto.File, error) {
+		return s.storage.GetFileByName(ctx, name)
+	})
+	if err != nil {
+		return dto.File{}, err
+	}
+	s.cache.Set(f)
+	return f, nil
+}
+
+// cachedContent отдает небольшой файл из кеша содержимого, при промахе читает
+// его с диска и кеширует. ok = false - файл нужно читать обычным путем.
+func (s *ServiceFile) cachedContent(ctx context.Context, name, path string) ([]byte, bool, error) {
+	// выключенный кеш не стоит запроса метаданных
+	if !s.content.Enabled() {
+		return nil, false, nil
+	}
+	f, err := s.lookupFile(ctx, name)
+	if err != nil {
+		if !errors.Is(err, storage.ErrNotFound) {
+			s.log(ctx).WithError(err).WithField("file", name).Warn("Cannot load file metadata, skipping content cache")
+		}
+		return nil, false, nil
+	}
+	if f.Checksum == "" || !s.content.Cacheable(f.Size) {
+		return nil, false, nil
+	}
+
+	if data, ok := s.content.Get(f.ID, f.Checksum); ok {
+		return data, true, nil
+	}
+
+	data, err := s.readShared(ctx, path)
+	if err != nil {
+		return nil, false, err
+	}
+
+	// файл на диске изменили в обход сервиса, такую версию не кешируем
+	sum := sha256.Sum256(data)
+	if hex.EncodeToString(sum[:]) != f.Checksum {
+		s.log(ctx).WithField("file", name).Warn("File checksum mismatch, not caching content")
+		return data, true, nil
+	}
+
+	s.content.Put(f.ID, f.Checksum, data)
+	return data, true, nil
+}
+
+// readShared читает файл целиком, одновременные чтения одного пути объединяются
+func (s *ServiceFile) readShared(ctx context.Context, path string) ([]byte, error) {
+	return s.reads.Do(ctx, path, func(ctx context.Context) ([]byte, error) {
+		_, read := startTransfer(ctx, "file.load", "", filepath.Base(path))
+		data, err := readFile(s.logger, path)
+		read.chunk(len(data))
+		read.end(err)
+		return data, err
+	})
+}
+
+func sendChunks(ctx context.Context, stream pb.FileService_DownloadFileStreamServer, data []byte, t *transfer) error {
+	for off := 0; off < len(data); off += downloadChunkSize {
+		if err := ctx.Err(); err != nil {
+			return status.FromContextError(err).Err()
+		}
+
+		chunk := data[off:min(off+downloadChunkSize, len(data))]
+		if err := stream.Send(&pb.DownloadResponse{Data: chunk}); err != nil {
+			return status.Errorf(codes.Internal, "failed to save file")
+		}
+		t.chunk(len(chunk))
+		audit.Annotate(stream.Context(), "", int64(len(chunk)))
+	}
+	return nil
+}
+
+func readFile(logger logrus.FieldLogger, path string) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, status.Error(codes.NotFound, "file not found")
+		}
+		logger.WithError(err).WithField("file", path).Error("Cannot read file")
+		return nil, status.Error(codes.Internal, "failed to download file")
+	}
+	return data, nil
+}
+
 func ensureDir(logger *logrus.Logger, dir string) bool {
 	_, err := os.Stat(dir)
 	if os.IsNotExist(err) {
@@ -0,0 +1,76 @@
+package service
+
+import (
+	"Tages/internal/metrics"
+	"Tages/internal/tracing"
+	"context"
+	"time"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+// transfer - спан и метрики цикла чтения или записи файла. Метрики пишутся,
+// только если задан method: внутренние чтения в них не попадают.
+// Байты считаются по чанкам, остальные метрики - только в end(nil).
+type transfer struct {
+	span      trace.Span
+	method    string
+	name      string
+	bytes     int64
+	chunks    int
+	started   time.Time
+	lastChunk time.Time
+	ended     bool
+}
+
+func startTransfer(ctx context.Context, op, method, filename string) (context.Context, *transfer) {
+	ctx, span := tracing.Start(ctx, op)
+	now := time.Now()
+	return ctx, &transfer{
+		span:      span,
+		method:    method,
+		name:      filename,
+		started:   now,
+		lastChunk: now,
+	}
+}
+
+func (t *transfer) setFile(name string) {
+	t.name = name
+}
+
+func (t *transfer) chunk(n int) {
+	now := time.Now()
+	t.bytes += int64(n)
+	t.chunks++
+
+	if t.method != "" {
+		metrics.TransferBytes.WithLabelValues(t.method).Add(float64(n))
+		metrics.TransferChunkLatency.WithLabelValues(t.method).Observe(now.Sub(t.lastChunk).Seconds())
+	}
+	t.lastChunk = now
+}
+
+// end можно вызывать повторно, учитывается первый вызов
+func (t *transfer) end(err error) {
+	if t.ended {
+		return
+	}
+	t.ended = true
+
+	t.span.SetAttributes(
+		tracing.AttrFileName.String(t.name),
+		tracing.AttrBytes.Int64(t.bytes),
+		tracing.AttrChunks.Int(t.chunks),
+	)
+	tracing.End(t.span, err)
+
+	if t.method == "" || err != nil {
+		return
+	}
+	metrics.TransferFileSize.WithLabelValues(t.method).Observe(float64(t.bytes))
+	metrics.TransferChunks.WithLabelValues(t.method).Observe(float64(t.chunks))
+	if elapsed := time.Since(t.started).Seconds(); elapsed > 0 && t.bytes > 0 {
+		metrics.TransferThroughput.WithLabelValues(t.method).Observe(float64(t.bytes) / elapsed)
+	}
+}
@@ -0,0 +1,68 @@
+package storage
+
+import (
+	"Tages/internal/dto"
+	"Tages/internal/metrics"
+	"context"
+	"time"
+)
+
+const maxAuditQueryLimit = 1000
+
+func (s *Storage) AddAuditEvents(ctx context.Context, events []dto.AuditEvent) error {
+	if len(events) == 0 {
+		return nil
+	}
+	start := time.Now()
+
+	// SQLite сравнивает время как строки, поэтому храним все в UTC
+	for i := range events {
+		events[i].OccurredAt = events[i].OccurredAt.UTC()
+	}
+	err := s.db(ctx).Create(&events).Error
+
+	status := "success"
+	if err != nil {
+		status = "error"
+	}
+
+	metrics.DBMetricsFunc(status, "add_audit_events", start)
+	return err
+}
+
+func (s *Storage) QueryAuditEvents(ctx context.Context, filter dto.AuditFilter) ([]dto.AuditEvent, error) {
+	start := time.Now()
+
+	q := s.db(ctx).Model(&dto.AuditEvent{})
+	if !filter.From.IsZero() {
+		q = q.Where("occurred_at >= ?", filter.From.UTC())
+	}
+	if !filter.To.IsZero() {
+		q = q.Where("occurred_at < ?", filter.To.UTC())
+	}
+	if filter.Actor != "" {
+		q = q.Where("actor = ?", filter.Actor)
+	}
+	if filter.FileName != "" {
+		q = q.Where("file_name = ?", filter.FileName)
+	}
+	if filter.AfterID > 0 {
+		q = q.Where("id > ?", filter.AfterID)
+	}
+
+	limit := filter.Limit
+	if limit <= 0 || limit > maxAuditQueryLimit {
+		limit = maxAuditQueryLimit
+	}
+
+	var events []dto.AuditEvent
+	err := q.Order("id").Limit(limit).Find(&events).Error
+
+	status := "success"
+	if err != nil {
+		status = "error"
+	}
+
+	metrics.DBMetricsFunc(status, "query_audit_events", start)
+	return events, err
+}
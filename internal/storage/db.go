@@ -7,6 +7,7 @@ import (
 	"time"
 
 	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
 )
@@ -18,10 +19,9 @@ type StorageInterface interface {
 	) error
 	AddFile(ctx context.Context, f dto.File) error
 	GetAllFiles(ctx context.Context) ([]dto.File, error)
+	GetFileByName(ctx context.Context, name string) (dto.File, error)
 }
 
-const ExtensionForPsg = `create extension if not exists "uuid-ossp"`
-
 // инкапсулируем логику создания подключения
 func newGorm(dsn string) (*gorm.DB, error) {
 	connect, err := gorm.Open(postgres.New(postgres.Config{
@@ -31,14 +31,42 @@ func newGorm(dsn string) (*gorm.DB, error) {
 	if err != nil {
 		return nil, errors.Wrap(err, "error in create db")
 	}
+	if err := connect.Use(metricsPlugin{}); err != nil {
+		return nil, errors.Wrap(err, "cant install metrics plugin")
+	}
 	return connect, err
 }
 
 type Storage struct {
 	conn *gorm.DB
+	// postgres или sqlite
+	dialect string
+	// канал NOTIFY для изменений файлов, пустой - не рассылаем
+	notifyChannel string
+	// попытки транзакции при конфликте сериализации и пауза между ними
+	txAttempts int
+	txBackoff  time.Duration
 }
 
+func newStorage(conn *gorm.DB, dialect string) *Storage {
+	return &Storage{
+		conn:       conn,
+		dialect:    dialect,
+		txAttempts: DefaultTxAttempts,
+		txBackoff:  DefaultTxBackoff,
+	}
+}
+
+// NewStorage подключается к Postgres или, для DSN вида sqlite://path, к SQLite
 func NewStorage(dsn string) (*Storage, error) {
+	if DialectOf(dsn) == DialectSQLite {
+		conn, err := newSQLite(dsn)
+		if err != nil {
+			return nil, errors.Wrap(err, "cannot open sqlite")
+		}
+		return newStorage(conn, DialectSQLite), nil
+	}
+
 	const (
 		maxRetries = 10
 		delay      = 1 * time.Second
@@ -50,7 +78,7 @@ func NewStorage(dsn string) (*Storage, error) {
 	for i := 0; i < maxRetries; i++ {
 		conn, err = newGorm(dsn)
 		if err == nil {
-			return &Storage{conn: conn}, nil
+			return newStorage(conn, DialectPostgres), nil
 		}
 		time.Sleep(delay)
 	}
@@ -66,48 +94,49 @@ func NewStorageWithDB(db *sql.DB) (*Storage, error) {
 	if err != nil {
 		return nil, errors.Wrap(err, "error in create db")
 	}
+	if err := conn.Use(metricsPlugin{}); err != nil {
+		return nil, errors.Wrap(err, "cant install metrics plugin")
+	}
 
-	return &Storage{
-		conn: conn,
-	}, nil
+	return newStorage(conn, DialectPostgres), nil
 }
 
-// migrator
-func (s *Storage) Init(ctx context.Context) error {
-	if err := s.conn.WithContext(ctx).Exec(ExtensionForPsg).Error; err != nil {
-		return errors.Wrap(err, "cant create extension for postgres")
+// Init приводит схему к версии бинарника: применяет недостающие миграции
+// и отказывается работать, если схема новее
+func (s *Storage) Init(ctx context.Context, logger *logrus.Logger) error {
+	m, err := s.Migrator(logger)
+	if err != nil {
+		return err
 	}
-
-	if err := s.conn.WithContext(ctx).AutoMigrate(&dto.File{}); err != nil {
-		return errors.Wrap(err, "failed to automigrate File")
+	applied, err := m.Up(ctx)
+	if err != nil {
+		return err
 	}
+	logger.WithFields(logrus.Fields{
+		"applied": applied,
+		"version": m.Latest(),
+	}).Info("Database schema is up to date")
 	return nil
 }
 
+// Dialect - бэкенд хранилища, DialectPostgres или DialectSQLite
+func (s *Storage) Dialect() string {
+	return s.dialect
+}
+
 // drop table
 func (s *Storage) Drop() error {
 	return s.conn.Migrator().DropTable(&dto.File{})
 }
 
-func (s *Storage) WithInTransaction(
-	ctx context.Context,
-	tFunc func(ctx context.Context) error,
-) error {
-	tx := s.conn.Begin()
-
-	err := tFunc(injectTx(ctx, tx))
+// Ping проверяет соединение с БД, используется в readiness
+func (s *Storage) Ping(ctx context.Context) error {
+	sql, err := s.conn.DB()
 	if err != nil {
-		tx.Rollback()
-		return err
+		return errors.Wrap(err, "failed to get sql.DB from gorm.DB")
 	}
 
-	tx.Commit()
-
-	return nil
-}
-
-func injectTx(ctx context.Context, tx *gorm.DB) context.Context {
-	return context.WithValue(ctx, tx.Callback(), tx)
+	return errors.Wrap(sql.PingContext(ctx), "db ping failed")
 }
 
 func (s *Storage) Close(ctx context.Context) error {
@@ -0,0 +1,89 @@
+package storage
+
+import (
+	"Tages/internal/metrics"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"gorm.io/gorm"
+)
+
+const startKey = "tages:query_start"
+
+// metricsPlugin считает каждый SQL-запрос GORM с метками операции, таблицы и исхода
+type metricsPlugin struct{}
+
+func (metricsPlugin) Name() string {
+	return "tages:metrics"
+}
+
+func (metricsPlugin) Initialize(db *gorm.DB) error {
+	cb := db.Callback()
+	hooks := []struct {
+		op     string
+		before func(name string, fn func(*gorm.DB)) error
+		after  func(name string, fn func(*gorm.DB)) error
+	}{
+		{"create", cb.Create().Before("gorm:create").Register, cb.Create().After("gorm:create").Register},
+		{"query", cb.Query().Before("gorm:query").Register, cb.Query().After("gorm:query").Register},
+		{"update", cb.Update().Before("gorm:update").Register, cb.Update().After("gorm:update").Register},
+		{"delete", cb.Delete().Before("gorm:delete").Register, cb.Delete().After("gorm:delete").Register},
+		{"row", cb.Row().Before("gorm:row").Register, cb.Row().After("gorm:row").Register},
+		{"raw", cb.Raw().Before("gorm:raw").Register, cb.Raw().After("gorm:raw").Register},
+	}
+
+	for _, h := range hooks {
+		if err := h.before("tages:metrics_before_"+h.op, startQuery); err != nil {
+			return errors.Wrapf(err, "cant register %s metrics callback", h.op)
+		}
+		if err := h.after("tages:metrics_after_"+h.op, observeQuery(h.op)); err != nil {
+			return errors.Wrapf(err, "cant register %s metrics callback", h.op)
+		}
+	}
+	return nil
+}
+
+func startQuery(db *gorm.DB) {
+	db.InstanceSet(startKey, time.Now())
+}
+
+func observeQuery(op string) func(*gorm.DB) {
+	return func(db *gorm.DB) {
+		v, ok := db.InstanceGet(startKey)
+		if !ok {
+			return
+		}
+		start, ok := v.(time.Time)
+		if !ok {
+			return
+		}
+
+		table := db.Statement.Table
+		if table == "" {
+			// raw и exec без модели
+			table = "none"
+		}
+
+		outcome := "success"
+		switch {
+		case errors.Is(db.Error, gorm.ErrRecordNotFound):
+			outcome = "not_found"
+		case db.Error != nil:
+			outcome = "error"
+		}
+
+		metrics.DBQueries.WithLabelValues(op, table, outcome).Inc()
+		metrics.DBQueryDuration.WithLabelValues(op, table, outcome).Observe(time.Since(start).Seconds())
+	}
+}
+
+// RegisterMetrics регистрирует метрики пула соединений (go_sql_*) из sql.DBStats
+func (s *Storage) RegisterMetrics(reg prometheus.Registerer) error {
+	sqlDB, err := s.conn.DB()
+	if err != nil {
+		return errors.Wrap(err, "failed to get sql.DB from gorm.DB")
+	}
+	return reg.Register(collectors.NewDBStatsCollector(sqlDB, "tages"))
+}
@@ -1,20 +1,33 @@
 package storage
 
 import (
+	"Tages/internal/accesslog"
 	"Tages/internal/dto"
 	"Tages/internal/metrics"
+	"Tages/internal/tracing"
 	"context"
 	"time"
 
+	"github.com/google/uuid"
 	"github.com/pkg/errors"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"gorm.io/gorm"
 )
 
 var ErrNotFound = errors.New("not found")
 
-func (s *Storage) AddFile(ctx context.Context, f dto.File) error {
+func (s *Storage) AddFile(ctx context.Context, f dto.File) (err error) {
+	ctx, span := tracing.Start(ctx, "storage.AddFile", tracing.AttrFileName.String(f.Name))
+	defer func() { tracing.End(span, err) }()
+
 	start := time.Now()
 
-	err := s.conn.WithContext(ctx).Create(&f).Error
+	// id генерируем сами: в SQLite нет uuid_generate_v4
+	if f.ID == uuid.Nil {
+		f.ID = uuid.New()
+	}
+	err = s.db(ctx).Create(&f).Error
 
 	status := "success"
 	if err != nil {
@@ -22,14 +35,24 @@ func (s *Storage) AddFile(ctx context.Context, f dto.File) error {
 	}
 
 	metrics.DBMetricsFunc(status, "add_file", start)
-	return err
+	if err != nil {
+		logFailure(ctx, "add_file", err)
+		return err
+	}
+
+	return s.publish(ctx, FileEvent{Op: FileEventUpsert, ID: f.ID, Name: f.Name})
 }
 
-func (s *Storage) GetAllFiles(ctx context.Context) ([]dto.File, error) {
+func (s *Storage) GetAllFiles(ctx context.Context) (files []dto.File, err error) {
+	ctx, span := tracing.Start(ctx, "storage.GetAllFiles")
+	defer func() {
+		span.SetAttributes(attribute.Int("db.rows", len(files)))
+		endSpan(span, err)
+	}()
+
 	start := time.Now()
 
-	var files []dto.File
-	err := s.conn.WithContext(ctx).Find(&files).Error
+	err = s.db(ctx).Find(&files).Error
 
 	status := "success"
 	if err != nil {
@@ -40,5 +63,44 @@ func (s *Storage) GetAllFiles(ctx context.Context) ([]dto.File, error) {
 	}
 
 	metrics.DBMetricsFunc(status, "get_all_files", start)
+	if status == "error" {
+		logFailure(ctx, "get_all_files", err)
+	}
 	return files, err
 }
+
+func (s *Storage) GetFileByName(ctx context.Context, name string) (f dto.File, err error) {
+	ctx, span := tracing.Start(ctx, "storage.GetFileByName", tracing.AttrFileName.String(name))
+	defer func() { endSpan(span, err) }()
+
+	start := time.Now()
+
+	err = s.db(ctx).Where("name = ?", name).Take(&f).Error
+
+	status := "success"
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		err = ErrNotFound
+		status = "not_found"
+	} else if err != nil {
+		status = "error"
+	}
+
+	metrics.DBMetricsFunc(status, "get_file_by_name", start)
+	if status == "error" {
+		logFailure(ctx, "get_file_by_name", err)
+	}
+	return f, err
+}
+
+// logFailure пишет ошибку запроса в лог вызова, чтобы ее можно было найти по x-request-id
+func logFailure(ctx context.Context, op string, err error) {
+	accesslog.FromContext(ctx).WithError(err).WithField("db.operation", op).Warn("Database query failed")
+}
+
+// endSpan закрывает спан, отсутствие записей ошибкой запроса не считается
+func endSpan(span trace.Span, err error) {
+	if errors.Is(err, ErrNotFound) {
+		err = nil
+	}
+	tracing.End(span, err)
+}
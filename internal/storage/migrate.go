@@ -0,0 +1,317 @@
+package storage
+
+import (
+	"context"
+	"embed"
+	"io/fs"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+// скрипты лежат в migrations/<dialect>, версии у диалектов общие
+//
+//go:embed migrations/postgres/*.sql migrations/sqlite/*.sql
+var embeddedMigrations embed.FS
+
+// ключ pg_advisory_lock, под которым реплики по очереди применяют миграции
+const migrationLockKey = 7_315_420_001
+
+// ErrSchemaAhead - в БД применены миграции, которых этот бинарник не знает
+var ErrSchemaAhead = errors.New("database schema is newer than this binary")
+
+// ErrSchemaBehind - в БД применены не все миграции
+var ErrSchemaBehind = errors.New("database schema is behind, run migrate up")
+
+// Migration - пара скриптов NNNN_name.up.sql и NNNN_name.down.sql
+type Migration struct {
+	Version int64
+	Name    string
+	Up      string
+	Down    string
+}
+
+// MigrationStatus - миграция и момент ее применения, nil - не применена
+type MigrationStatus struct {
+	Version   int64
+	Name      string
+	AppliedAt *time.Time
+}
+
+type schemaMigration struct {
+	Version   int64     `gorm:"primaryKey;autoIncrement:false"`
+	Name      string    `gorm:"not null"`
+	AppliedAt time.Time `gorm:"not null"`
+}
+
+func (schemaMigration) TableName() string {
+	return "schema_migrations"
+}
+
+var migrationFile = regexp.MustCompile(`^(\d+)_([a-z0-9_]+)\.(up|down)\.sql$`)
+
+// LoadMigrations читает миграции из каталога fsys и сортирует по версии
+func LoadMigrations(fsys fs.FS, dir string) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return nil, errors.Wrap(err, "cant read migrations")
+	}
+
+	byVersion := make(map[int64]*Migration)
+	for _, e := range entries {
+		m := migrationFile.FindStringSubmatch(e.Name())
+		if m == nil {
+			return nil, errors.Errorf("unexpected migration file %q", e.Name())
+		}
+		version, _ := strconv.ParseInt(m[1], 10, 64)
+		body, err := fs.ReadFile(fsys, path.Join(dir, e.Name()))
+		if err != nil {
+			return nil, errors.Wrapf(err, "cant read migration %s", e.Name())
+		}
+
+		mig, ok := byVersion[version]
+		if !ok {
+			mig = &Migration{Version: version, Name: m[2]}
+			byVersion[version] = mig
+		}
+		if mig.Name != m[2] {
+			return nil, errors.Errorf("migration %d has two names: %s and %s", version, mig.Name, m[2])
+		}
+		if m[3] == "up" {
+			mig.Up = string(body)
+		} else {
+			mig.Down = string(body)
+		}
+	}
+
+	out := make([]Migration, 0, len(byVersion))
+	for _, mig := range byVersion {
+		if mig.Up == "" || mig.Down == "" {
+			return nil, errors.Errorf("migration %d_%s needs both up and down scripts", mig.Version, mig.Name)
+		}
+		out = append(out, *mig)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Version < out[j].Version })
+	return out, nil
+}
+
+// Migrator применяет и откатывает миграции. Все операции идут на одном
+// соединении, в Postgres - под advisory lock, поэтому одновременно стартующие
+// реплики не применяют одну миграцию дважды. SQLite - однонодовый режим,
+// блокировка не нужна. Каждая миграция - отдельная транзакция.
+type Migrator struct {
+	conn       *gorm.DB
+	dialect    string
+	migrations []Migration
+	logger     *logrus.Logger
+}
+
+func (s *Storage) Migrator(logger *logrus.Logger) (*Migrator, error) {
+	migrations, err := LoadMigrations(embeddedMigrations, "migrations/"+s.dialect)
+	if err != nil {
+		return nil, err
+	}
+	return NewMigrator(s.conn, s.dialect, migrations, logger), nil
+}
+
+func NewMigrator(conn *gorm.DB, dialect string, migrations []Migration, logger *logrus.Logger) *Migrator {
+	return &Migrator{conn: conn, dialect: dialect, migrations: migrations, logger: logger}
+}
+
+// Latest - последняя версия, известная бинарнику
+func (m *Migrator) Latest() int64 {
+	if len(m.migrations) == 0 {
+		return 0
+	}
+	return m.migrations[len(m.migrations)-1].Version
+}
+
+// Up применяет все неприменные миграции, возвращает их число
+func (m *Migrator) Up(ctx context.Context) (int, error) {
+	applied := 0
+	err := m.locked(ctx, func(db *gorm.DB) error {
+		done, err := m.applied(db)
+		if err != nil {
+			return err
+		}
+		if err := m.checkAhead(done); err != nil {
+			return err
+		}
+
+		for _, mig := range m.migrations {
+			if _, ok := done[mig.Version]; ok {
+				continue
+			}
+			if err := m.run(db, mig, true); err != nil {
+				return err
+			}
+			applied++
+		}
+		return nil
+	})
+	return applied, err
+}
+
+// Down откатывает steps последних примененных миграций
+func (m *Migrator) Down(ctx context.Context, steps int) (int, error) {
+	reverted := 0
+	err := m.locked(ctx, func(db *gorm.DB) error {
+		done, err := m.applied(db)
+		if err != nil {
+			return err
+		}
+		if err := m.checkAhead(done); err != nil {
+			return err
+		}
+
+		for i := len(m.migrations) - 1; i >= 0 && reverted < steps; i-- {
+			mig := m.migrations[i]
+			if _, ok := done[mig.Version]; !ok {
+				continue
+			}
+			if err := m.run(db, mig, false); err != nil {
+				return err
+			}
+			reverted++
+		}
+		return nil
+	})
+	return reverted, err
+}
+
+// Status - все известные миграции и отметка о применении
+func (m *Migrator) Status(ctx context.Context) ([]MigrationStatus, error) {
+	db := m.conn.WithContext(ctx)
+	if err := m.ensureTable(db); err != nil {
+		return nil, err
+	}
+	done, err := m.applied(db)
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([]MigrationStatus, 0, len(m.migrations))
+	for _, mig := range m.migrations {
+		st := MigrationStatus{Version: mig.Version, Name: mig.Name}
+		if row, ok := done[mig.Version]; ok {
+			at := row.AppliedAt
+			st.AppliedAt = &at
+		}
+		out = append(out, st)
+	}
+	return out, m.checkAhead(done)
+}
+
+// Require проверяет, что схема ровно той версии, которую ждет бинарник
+func (m *Migrator) Require(ctx context.Context) error {
+	status, err := m.Status(ctx)
+	if err != nil {
+		return err
+	}
+	for _, st := range status {
+		if st.AppliedAt == nil {
+			return errors.Wrapf(ErrSchemaBehind, "migration %d_%s is not applied", st.Version, st.Name)
+		}
+	}
+	return nil
+}
+
+func (m *Migrator) checkAhead(done map[int64]schemaMigration) error {
+	latest := m.Latest()
+	for version, row := range done {
+		if version > latest {
+			return errors.Wrapf(ErrSchemaAhead, "migration %d_%s is applied, binary knows up to %d", version, row.Name, latest)
+		}
+	}
+	return nil
+}
+
+// locked выполняет fn на одном соединении под advisory lock
+func (m *Migrator) locked(ctx context.Context, fn func(db *gorm.DB) error) error {
+	return m.conn.WithContext(ctx).Connection(func(db *gorm.DB) error {
+		if m.dialect != DialectPostgres {
+			if err := m.ensureTable(db); err != nil {
+				return err
+			}
+			return fn(db)
+		}
+
+		if err := db.Exec("select pg_advisory_lock(?)", migrationLockKey).Error; err != nil {
+			return errors.Wrap(err, "cant take migration lock")
+		}
+		defer func() {
+			// ctx мог быть отменен, а блокировку нужно снять в любом случае
+			if err := db.WithContext(context.Background()).Exec("select pg_advisory_unlock(?)", migrationLockKey).Error; err != nil {
+				m.logger.WithError(err).Warn("Failed to release migration lock")
+			}
+		}()
+
+		if err := m.ensureTable(db); err != nil {
+			return err
+		}
+		return fn(db)
+	})
+}
+
+func (m *Migrator) ensureTable(db *gorm.DB) error {
+	// драйвер SQLite разбирает время только из колонок datetime/timestamp
+	timeType := "timestamptz"
+	if m.dialect == DialectSQLite {
+		timeType = "datetime"
+	}
+	err := db.Exec(`create table if not exists schema_migrations (
+	version bigint primary key,
+	name text not null,
+	applied_at ` + timeType + ` not null
+)`).Error
+	return errors.Wrap(err, "cant create schema_migrations")
+}
+
+func (m *Migrator) applied(db *gorm.DB) (map[int64]schemaMigration, error) {
+	var rows []schemaMigration
+	if err := db.Order("version").Find(&rows).Error; err != nil {
+		return nil, errors.Wrap(err, "cant read schema_migrations")
+	}
+	done := make(map[int64]schemaMigration, len(rows))
+	for _, row := range rows {
+		done[row.Version] = row
+	}
+	return done, nil
+}
+
+// run применяет (up) или откатывает миграцию вместе с записью в schema_migrations
+func (m *Migrator) run(db *gorm.DB, mig Migration, up bool) error {
+	direction, script := "up", mig.Up
+	if !up {
+		direction, script = "down", mig.Down
+	}
+	log := m.logger.WithFields(logrus.Fields{
+		"version":   mig.Version,
+		"name":      mig.Name,
+		"direction": direction,
+	})
+	log.Info("Applying migration")
+	start := time.Now()
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec(script).Error; err != nil {
+			return err
+		}
+		if up {
+			return tx.Create(&schemaMigration{Version: mig.Version, Name: mig.Name, AppliedAt: time.Now().UTC()}).Error
+		}
+		return tx.Delete(&schemaMigration{}, mig.Version).Error
+	})
+	if err != nil {
+		return errors.Wrapf(err, "migration %d_%s %s failed", mig.Version, mig.Name, direction)
+	}
+
+	log.WithField("duration", time.Since(start).String()).Info("Migration applied")
+	return nil
+}
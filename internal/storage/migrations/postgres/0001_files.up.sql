@@ -0,0 +1,15 @@
+-- таблица файлов, совместима со схемой, которую раньше создавал AutoMigrate
+create extension if not exists "uuid-ossp";
+
+create table if not exists files (
+	id uuid primary key default uuid_generate_v4(),
+	name text,
+	path text,
+	size bigint,
+	checksum text,
+	created_at timestamptz,
+	updated_at timestamptz
+);
+
+alter table files add column if not exists size bigint;
+alter table files add column if not exists checksum text;
@@ -0,0 +1,32 @@
+create table if not exists audit_events (
+	id bigserial primary key,
+	occurred_at timestamptz not null,
+	actor text not null,
+	peer text,
+	method text not null,
+	file_name text,
+	bytes bigint,
+	code text not null,
+	latency_micros bigint
+);
+
+create index if not exists idx_audit_events_occurred_at on audit_events (occurred_at);
+create index if not exists idx_audit_events_actor on audit_events (actor);
+create index if not exists idx_audit_events_file_name on audit_events (file_name);
+
+-- запрещаем update/delete/truncate, журнал аудита только пополняется
+create or replace function audit_events_append_only() returns trigger as $$
+begin
+	raise exception 'audit_events is append-only';
+end;
+$$ language plpgsql;
+
+drop trigger if exists audit_events_no_modify on audit_events;
+create trigger audit_events_no_modify
+	before update or delete on audit_events
+	for each row execute function audit_events_append_only();
+
+drop trigger if exists audit_events_no_truncate on audit_events;
+create trigger audit_events_no_truncate
+	before truncate on audit_events
+	for each statement execute function audit_events_append_only();
@@ -0,0 +1,2 @@
+-- GetFileByName и события реплик ищут файл по имени
+create index if not exists idx_files_name on files (name);
@@ -0,0 +1,10 @@
+-- id генерирует приложение, в SQLite нет uuid_generate_v4
+create table if not exists files (
+	id text primary key,
+	name text,
+	path text,
+	size integer,
+	checksum text,
+	created_at datetime,
+	updated_at datetime
+);
@@ -0,0 +1,28 @@
+create table if not exists audit_events (
+	id integer primary key autoincrement,
+	occurred_at datetime not null,
+	actor text not null,
+	peer text,
+	method text not null,
+	file_name text,
+	bytes integer,
+	code text not null,
+	latency_micros integer
+);
+
+create index if not exists idx_audit_events_occurred_at on audit_events (occurred_at);
+create index if not exists idx_audit_events_actor on audit_events (actor);
+create index if not exists idx_audit_events_file_name on audit_events (file_name);
+
+-- журнал аудита только пополняется; truncate в SQLite нет, delete ловит триггер
+create trigger if not exists audit_events_no_update
+	before update on audit_events
+begin
+	select raise(abort, 'audit_events is append-only');
+end;
+
+create trigger if not exists audit_events_no_delete
+	before delete on audit_events
+begin
+	select raise(abort, 'audit_events is append-only');
+end;
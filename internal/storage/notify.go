@@ -0,0 +1,167 @@
+package storage
+
+import (
+	"Tages/internal/metrics"
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+const DefaultNotifyChannel = "tages_files"
+
+const (
+	FileEventUpsert = "upsert"
+	FileEventDelete = "delete"
+)
+
+// FileEvent - изменение файла, рассылается репликам через NOTIFY.
+// В payload только ключи, свежие метаданные реплика читает из БД сама.
+type FileEvent struct {
+	Op   string    `json:"op"`
+	ID   uuid.UUID `json:"id"`
+	Name string    `json:"name"`
+}
+
+// SetNotifyChannel включает рассылку изменений файлов, пустой канал - выключена
+func (s *Storage) SetNotifyChannel(channel string) {
+	s.notifyChannel = channel
+}
+
+func (s *Storage) publish(ctx context.Context, ev FileEvent) error {
+	if s.notifyChannel == "" {
+		return nil
+	}
+
+	// в транзакции событие уходит вместе с коммитом
+	if st, ok := ctx.Value(txKey{}).(*txState); ok {
+		st.events = append(st.events, ev)
+		return nil
+	}
+
+	return s.notify(s.db(ctx), []FileEvent{ev})
+}
+
+func (s *Storage) notify(db *gorm.DB, events []FileEvent) error {
+	for _, ev := range events {
+		payload, err := json.Marshal(ev)
+		if err != nil {
+			return errors.Wrap(err, "cant encode file event")
+		}
+		if err := db.Exec("select pg_notify(?, ?)", s.notifyChannel, string(payload)).Error; err != nil {
+			return errors.Wrap(err, "cant publish file event")
+		}
+	}
+	return nil
+}
+
+// DecodeFileEvent разбирает payload уведомления
+func DecodeFileEvent(payload string) (FileEvent, error) {
+	var ev FileEvent
+	if err := json.Unmarshal([]byte(payload), &ev); err != nil {
+		return FileEvent{}, errors.Wrap(err, "cant decode file event")
+	}
+	switch ev.Op {
+	case FileEventUpsert, FileEventDelete:
+	default:
+		return FileEvent{}, errors.Errorf("unknown file event op %q", ev.Op)
+	}
+	if ev.Name == "" {
+		return FileEvent{}, errors.New("file event without name")
+	}
+	return ev, nil
+}
+
+// Listener держит отдельное соединение с LISTEN и применяет события реплики.
+// Пока соединения нет, события теряются, поэтому после каждого LISTEN, включая
+// первый, вызывается полная пересинхронизация: прогрев при старте мог
+// прочитать список раньше, чем начал работать LISTEN.
+type Listener struct {
+	dsn     string
+	channel string
+	logger  *logrus.Logger
+	handle  func(ctx context.Context, ev FileEvent)
+	resync  func(ctx context.Context) error
+}
+
+func NewListener(
+	dsn, channel string,
+	logger *logrus.Logger,
+	handle func(ctx context.Context, ev FileEvent),
+	resync func(ctx context.Context) error,
+) *Listener {
+	return &Listener{
+		dsn:     dsn,
+		channel: channel,
+		logger:  logger,
+		handle:  handle,
+		resync:  resync,
+	}
+}
+
+func (l *Listener) Run(ctx context.Context) {
+	const (
+		minBackoff = time.Second
+		maxBackoff = 30 * time.Second
+	)
+
+	backoff := minBackoff
+	for ctx.Err() == nil {
+		err := l.listen(ctx, func() {
+			backoff = minBackoff
+		})
+		if ctx.Err() != nil {
+			return
+		}
+
+		metrics.CacheNotifyReconnects.Inc()
+		l.logger.WithError(err).WithField("retry_in", backoff).Warn("File event listener disconnected")
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		backoff = min(backoff*2, maxBackoff)
+	}
+}
+
+func (l *Listener) listen(ctx context.Context, onListen func()) error {
+	conn, err := pgx.Connect(ctx, l.dsn)
+	if err != nil {
+		return errors.Wrap(err, "cant connect listener")
+	}
+	defer conn.Close(context.WithoutCancel(ctx))
+
+	if _, err := conn.Exec(ctx, "listen "+pgx.Identifier{l.channel}.Sanitize()); err != nil {
+		return errors.Wrap(err, "cant listen for file events")
+	}
+	onListen()
+	l.logger.WithField("channel", l.channel).Info("Listening for file events")
+
+	// события до LISTEN не дошли, сверяемся с БД уже под подпиской
+	metrics.CacheNotifyResyncs.Inc()
+	if err := l.resync(ctx); err != nil {
+		l.logger.WithError(err).Warn("Cache resync after listen failed")
+	}
+
+	for {
+		n, err := conn.WaitForNotification(ctx)
+		if err != nil {
+			return errors.Wrap(err, "wait for notification")
+		}
+
+		ev, err := DecodeFileEvent(n.Payload)
+		if err != nil {
+			l.logger.WithError(err).Warn("Skipping malformed file event")
+			continue
+		}
+		metrics.CacheNotifyEvents.WithLabelValues(ev.Op).Inc()
+		l.handle(ctx, ev)
+	}
+}
@@ -0,0 +1,66 @@
+package storage
+
+import (
+	"strings"
+
+	"github.com/glebarez/sqlite"
+	"github.com/pkg/errors"
+	"gorm.io/gorm"
+)
+
+const (
+	DialectPostgres = "postgres"
+	DialectSQLite   = "sqlite"
+)
+
+const sqliteScheme = "sqlite://"
+
+// sqlitePragmas - WAL, чтобы чтение не ждало записи; busy_timeout и
+// immediate-транзакции, чтобы конкурентные записи ждали блокировку, а не
+// падали с SQLITE_BUSY при повышении блокировки посреди транзакции
+var sqlitePragmas = []string{
+	"_pragma=journal_mode(WAL)",
+	"_pragma=busy_timeout(5000)",
+	"_pragma=foreign_keys(1)",
+	"_txlock=immediate",
+}
+
+// DialectOf определяет бэкенд по схеме DSN: sqlite://path и file:path - SQLite,
+// остальное - Postgres
+func DialectOf(dsn string) string {
+	if strings.HasPrefix(dsn, sqliteScheme) || strings.HasPrefix(dsn, "file:") {
+		return DialectSQLite
+	}
+	return DialectPostgres
+}
+
+// sqliteDSN переводит sqlite://path?params в DSN драйвера и добавляет прагмы
+func sqliteDSN(dsn string) string {
+	dsn = strings.TrimPrefix(dsn, sqliteScheme)
+	sep := "?"
+	if strings.Contains(dsn, "?") {
+		sep = "&"
+	}
+	return dsn + sep + strings.Join(sqlitePragmas, "&")
+}
+
+func newSQLite(dsn string) (*gorm.DB, error) {
+	connect, err := gorm.Open(sqlite.Open(sqliteDSN(dsn)))
+	if err != nil {
+		return nil, errors.Wrap(err, "error in create db")
+	}
+
+	// у каждого соединения своя база в памяти, держим одно
+	if strings.Contains(dsn, ":memory:") || strings.Contains(dsn, "mode=memory") {
+		sqlDB, err := connect.DB()
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to get sql.DB from gorm.DB")
+		}
+		sqlDB.SetMaxOpenConns(1)
+	}
+
+	if err := connect.Use(metricsPlugin{}); err != nil {
+		return nil, errors.Wrap(err, "cant install metrics plugin")
+	}
+	return connect, nil
+}
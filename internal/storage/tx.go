@@ -0,0 +1,173 @@
+package storage
+
+import (
+	"Tages/internal/accesslog"
+	"Tages/internal/metrics"
+	"Tages/internal/tracing"
+	"context"
+	"fmt"
+	"math/rand/v2"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/pkg/errors"
+	"go.opentelemetry.io/otel/attribute"
+	"gorm.io/gorm"
+)
+
+const (
+	// коды SQLSTATE, после которых транзакцию можно повторить целиком
+	sqlStateSerializationFailure = "40001"
+	sqlStateDeadlockDetected     = "40P01"
+
+	DefaultTxAttempts = 3
+	DefaultTxBackoff  = 20 * time.Millisecond
+)
+
+// txKey - ключ контекста с активной транзакцией
+type txKey struct{}
+
+// txState - единица работы: транзакция, глубина вложенности для savepoint'ов
+// и события, которые уйдут в NOTIFY перед коммитом. Postgres доставит их
+// слушателям только если транзакция зафиксируется.
+type txState struct {
+	tx     *gorm.DB
+	depth  int
+	events []FileEvent
+}
+
+// db - соединение для запроса: транзакция из ctx или общее соединение.
+// Все методы хранилища ходят в БД только через него.
+func (s *Storage) db(ctx context.Context) *gorm.DB {
+	if st, ok := ctx.Value(txKey{}).(*txState); ok {
+		return st.tx.WithContext(ctx)
+	}
+	return s.conn.WithContext(ctx)
+}
+
+// SetTxRetry задает число попыток транзакции при конфликте сериализации
+// или дедлоке и базовую паузу между ними
+func (s *Storage) SetTxRetry(attempts int, backoff time.Duration) {
+	if attempts <= 0 {
+		attempts = DefaultTxAttempts
+	}
+	s.txAttempts = attempts
+	s.txBackoff = backoff
+}
+
+// WithInTransaction выполняет tFunc в транзакции: методы хранилища, вызванные
+// с переданным ctx, работают в ней. Ошибка tFunc откатывает транзакцию,
+// ошибка коммита возвращается. Вложенный вызов открывает savepoint и при
+// ошибке откатывает только свою часть. При конфликте сериализации или дедлоке
+// транзакция повторяется целиком, поэтому tFunc не должна иметь побочных
+// эффектов вне БД.
+func (s *Storage) WithInTransaction(
+	ctx context.Context,
+	tFunc func(ctx context.Context) error,
+) (err error) {
+	if st, ok := ctx.Value(txKey{}).(*txState); ok {
+		return s.withSavepoint(ctx, st, tFunc)
+	}
+
+	ctx, span := tracing.Start(ctx, "storage.WithInTransaction")
+	attempt := 0
+	defer func() {
+		span.SetAttributes(attribute.Int("db.tx.attempts", attempt))
+		tracing.End(span, err)
+	}()
+
+	for {
+		attempt++
+		err = s.runTx(ctx, tFunc)
+		if err == nil || !retryable(err) || attempt >= s.txAttempts {
+			return err
+		}
+
+		metrics.StorageTxRetries.Inc()
+		accesslog.FromContext(ctx).WithError(err).WithField("attempt", attempt).Warn("Retrying transaction")
+
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(s.retryDelay(attempt)):
+		}
+	}
+}
+
+// runTx - одна попытка транзакции верхнего уровня
+func (s *Storage) runTx(ctx context.Context, tFunc func(ctx context.Context) error) (err error) {
+	tx := s.conn.WithContext(ctx).Begin()
+	if tx.Error != nil {
+		return errors.Wrap(tx.Error, "cant begin transaction")
+	}
+
+	st := &txState{tx: tx}
+	defer func() {
+		// паника в tFunc не должна оставлять открытую транзакцию
+		if p := recover(); p != nil {
+			tx.Rollback()
+			panic(p)
+		}
+	}()
+
+	if err := tFunc(context.WithValue(ctx, txKey{}, st)); err != nil {
+		accesslog.FromContext(ctx).WithError(err).Debug("Transaction rolled back")
+		tx.Rollback()
+		return err
+	}
+
+	if err := s.notify(tx, st.events); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		return errors.Wrap(err, "cant commit transaction")
+	}
+	return nil
+}
+
+// withSavepoint выполняет вложенную единицу работы внутри savepoint
+func (s *Storage) withSavepoint(ctx context.Context, st *txState, tFunc func(ctx context.Context) error) (err error) {
+	st.depth++
+	name := fmt.Sprintf("sp_%d", st.depth)
+	events := len(st.events)
+	defer func() { st.depth-- }()
+
+	if err := st.tx.WithContext(ctx).SavePoint(name).Error; err != nil {
+		return errors.Wrap(err, "cant create savepoint")
+	}
+
+	if err := tFunc(ctx); err != nil {
+		// события откаченной части тоже не отправляем
+		st.events = st.events[:events]
+		if rbErr := st.tx.WithContext(ctx).RollbackTo(name).Error; rbErr != nil {
+			return errors.Wrapf(err, "rollback to savepoint failed: %v", rbErr)
+		}
+		return err
+	}
+
+	if err := st.tx.WithContext(ctx).Exec("RELEASE SAVEPOINT " + name).Error; err != nil {
+		return errors.Wrap(err, "cant release savepoint")
+	}
+	return nil
+}
+
+// retryDelay - экспоненциальная пауза с джиттером, чтобы конфликтующие
+// транзакции не столкнулись снова
+func (s *Storage) retryDelay(attempt int) time.Duration {
+	if s.txBackoff <= 0 {
+		return 0
+	}
+	d := s.txBackoff << (attempt - 1)
+	return d/2 + rand.N(d/2+1)
+}
+
+// retryable - ошибка конфликта, после которой транзакцию можно повторить
+func retryable(err error) bool {
+	var pgErr *pgconn.PgError
+	if !errors.As(err, &pgErr) {
+		return false
+	}
+	return pgErr.Code == sqlStateSerializationFailure || pgErr.Code == sqlStateDeadlockDetected
+}
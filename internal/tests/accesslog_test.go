@@ -0,0 +1,203 @@
+package tests
+
+import (
+	"Tages/internal/accesslog"
+	"Tages/internal/cache"
+	"Tages/internal/clientinfo"
+	"Tages/internal/dto"
+	"Tages/internal/service"
+	pb "Tages/pkg"
+	"Tages/pkg/mocks"
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	logtest "github.com/sirupsen/logrus/hooks/test"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+func accessEntries(hook *logtest.Hook) []*logrus.Entry {
+	var out []*logrus.Entry
+	for _, e := range hook.AllEntries() {
+		if e.Message == "access" {
+			out = append(out, e)
+		}
+	}
+	return out
+}
+
+func TestAccessLogPropagatesRequestID(t *testing.T) {
+	logger, hook := logtest.NewNullLogger()
+	trusted, err := clientinfo.ParseCIDRs([]string{"10.0.0.0/8"})
+	require.NoError(t, err)
+	a := accesslog.New(accesslog.DefaultConfig, logger, trusted)
+
+	ctx := metadata.NewIncomingContext(peerCtx("10.0.0.1", 5000), metadata.Pairs(
+		accesslog.RequestIDHeader, "req-42",
+		"x-client-id", "alice",
+	))
+	info := &grpc.UnaryServerInfo{FullMethod: "/tages.service.FileService/ListFiles"}
+
+	var seen string
+	_, err = a.UnaryInterceptor()(ctx, &pb.ListRequest{}, info, func(ctx context.Context, req interface{}) (interface{}, error) {
+		seen = accesslog.RequestID(ctx)
+		accesslog.FromContext(ctx).Info("inside handler")
+		return &pb.ListResponse{Files: []*pb.FileInfo{{Name: "a.txt"}}}, nil
+	})
+	require.NoError(t, err)
+	require.Equal(t, "req-42", seen)
+
+	entries := hook.AllEntries()
+	require.Len(t, entries, 2)
+	require.Equal(t, "req-42", entries[0].Data["request_id"])
+
+	access := accessEntries(hook)
+	require.Len(t, access, 1)
+	require.Equal(t, "req-42", access[0].Data["request_id"])
+	require.Equal(t, info.FullMethod, access[0].Data["method"])
+	require.Equal(t, "alice", access[0].Data["identity"])
+	require.Equal(t, "OK", access[0].Data["code"])
+	require.Greater(t, access[0].Data["bytes_out"], int64(0))
+}
+
+func TestAccessLogIgnoresUntrustedClientID(t *testing.T) {
+	logger, hook := logtest.NewNullLogger()
+	trusted, err := clientinfo.ParseCIDRs([]string{"10.0.0.0/8"})
+	require.NoError(t, err)
+	a := accesslog.New(accesslog.DefaultConfig, logger, trusted)
+
+	// x-client-id от клиента напрямую - не повод записать его под чужим именем
+	ctx := metadata.NewIncomingContext(peerCtx("203.0.113.5", 5000), metadata.Pairs("x-client-id", "alice"))
+	info := &grpc.UnaryServerInfo{FullMethod: "/tages.service.FileService/ListFiles"}
+	_, err = a.UnaryInterceptor()(ctx, nil, info, func(ctx context.Context, req interface{}) (interface{}, error) {
+		return nil, nil
+	})
+	require.NoError(t, err)
+
+	access := accessEntries(hook)
+	require.Len(t, access, 1)
+	require.Equal(t, clientinfo.Anonymous, access[0].Data["identity"])
+}
+
+func TestAccessLogGeneratesRequestID(t *testing.T) {
+	logger, hook := logtest.NewNullLogger()
+	a := accesslog.New(accesslog.DefaultConfig, logger, nil)
+
+	// пробелы и управляющие символы в идентификаторе не принимаются
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(accesslog.RequestIDHeader, "bad id\n"))
+	info := &grpc.UnaryServerInfo{FullMethod: "/tages.service.FileService/ListFiles"}
+
+	var seen string
+	_, err := a.UnaryInterceptor()(ctx, nil, info, func(ctx context.Context, req interface{}) (interface{}, error) {
+		seen = accesslog.RequestID(ctx)
+		return nil, nil
+	})
+	require.NoError(t, err)
+	require.NotEmpty(t, seen)
+	require.NotEqual(t, "bad id\n", seen)
+	require.Equal(t, seen, accessEntries(hook)[0].Data["request_id"])
+}
+
+func TestAccessLogSampling(t *testing.T) {
+	logger, hook := logtest.NewNullLogger()
+	a := accesslog.New(accesslog.Config{Enabled: true, SampleRatio: 0}, logger, nil)
+	info := &grpc.UnaryServerInfo{FullMethod: "/tages.service.FileService/ListFiles"}
+
+	for i := 0; i < 10; i++ {
+		_, _ = a.UnaryInterceptor()(context.Background(), nil, info, func(ctx context.Context, req interface{}) (interface{}, error) {
+			return nil, nil
+		})
+	}
+	require.Empty(t, accessEntries(hook))
+
+	// ошибки пишутся независимо от выборки
+	_, _ = a.UnaryInterceptor()(context.Background(), nil, info, func(ctx context.Context, req interface{}) (interface{}, error) {
+		return nil, status.Error(codes.Internal, "boom")
+	})
+	access := accessEntries(hook)
+	require.Len(t, access, 1)
+	require.Equal(t, "Internal", access[0].Data["code"])
+	require.Equal(t, logrus.ErrorLevel, access[0].Level)
+
+	a.SetConfig(accesslog.Config{Enabled: false, SampleRatio: 1})
+	_, _ = a.UnaryInterceptor()(context.Background(), nil, info, func(ctx context.Context, req interface{}) (interface{}, error) {
+		return nil, status.Error(codes.Internal, "boom")
+	})
+	require.Len(t, accessEntries(hook), 1)
+}
+
+func TestAccessLogConfig(t *testing.T) {
+	v := viper.New()
+	v.Set("log.access.sample_ratio", 0.25)
+	cfg, err := accesslog.LoadConfig(v)
+	require.NoError(t, err)
+	require.True(t, cfg.Enabled)
+	require.Equal(t, 0.25, cfg.SampleRatio)
+
+	v.Set("log.access.sample_ratio", 2)
+	_, err = accesslog.LoadConfig(v)
+	require.Error(t, err)
+}
+
+// countedStream - поток, в который пишет и из которого читает обработчик
+type countedStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *countedStream) Context() context.Context    { return s.ctx }
+func (s *countedStream) SetHeader(metadata.MD) error { return nil }
+func (s *countedStream) SendMsg(m interface{}) error { return nil }
+func (s *countedStream) RecvMsg(m interface{}) error {
+	*(m.(*pb.UploadRequest)) = pb.UploadRequest{Filename: "f", Data: make([]byte, 100)}
+	return nil
+}
+
+func TestAccessLogStreamBytes(t *testing.T) {
+	logger, hook := logtest.NewNullLogger()
+	a := accesslog.New(accesslog.DefaultConfig, logger, nil)
+	info := &grpc.StreamServerInfo{FullMethod: "/tages.service.FileService/UploadFileStream"}
+
+	err := a.StreamInterceptor()(nil, &countedStream{ctx: context.Background()}, info, func(srv interface{}, ss grpc.ServerStream) error {
+		require.NotEmpty(t, accesslog.RequestID(ss.Context()))
+		for i := 0; i < 3; i++ {
+			require.NoError(t, ss.RecvMsg(&pb.UploadRequest{}))
+		}
+		return ss.SendMsg(&pb.UploadResponse{Status: true})
+	})
+	require.NoError(t, err)
+
+	access := accessEntries(hook)
+	require.Len(t, access, 1)
+	require.Greater(t, access[0].Data["bytes_in"], int64(300))
+	require.Greater(t, access[0].Data["bytes_out"], int64(0))
+}
+
+func TestServiceLogsWithRequestLogger(t *testing.T) {
+	viper.Set("upload.dir", t.TempDir())
+	logger, hook := logtest.NewNullLogger()
+	c := cache.NewCache(logrus.New(), make(chan float64, 1))
+	mockStorage := &mocks.MockStorage{
+		AddFileFn: func(ctx context.Context, f dto.File) error { return errors.New("db down") },
+		WithInTransactionFn: func(ctx context.Context, fn func(context.Context) error) error {
+			return fn(ctx)
+		},
+	}
+	srv, err := service.NewServicefile(context.Background(), logrus.New(), c, mockStorage)
+	require.NoError(t, err)
+
+	ctx := accesslog.WithLogger(context.Background(), logger.WithField("request_id", "req-7"))
+	_, err = srv.UploadFileUnary(ctx, &pb.UploadRequest{Filename: "a.txt", Data: []byte("x")})
+	require.Error(t, err)
+
+	require.NotEmpty(t, hook.AllEntries())
+	for _, e := range hook.AllEntries() {
+		require.Equal(t, "req-7", e.Data["request_id"])
+	}
+}
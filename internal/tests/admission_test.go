@@ -0,0 +1,122 @@
+package tests
+
+import (
+	"Tages/internal/admission"
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestAdmissionPerClientCap(t *testing.T) {
+	pool := admission.NewPool("test", admission.Config{Slots: 3, PerClient: 1, QueueTimeout: 50 * time.Millisecond})
+
+	releaseA, err := pool.Acquire(context.Background(), "a")
+	require.NoError(t, err)
+
+	// второй вызов того же клиента упирается в свой лимит, хотя слоты есть
+	_, err = pool.Acquire(context.Background(), "a")
+	require.Equal(t, codes.Unavailable, status.Code(err))
+
+	releaseB, err := pool.Acquire(context.Background(), "b")
+	require.NoError(t, err)
+
+	releaseA()
+	releaseA2, err := pool.Acquire(context.Background(), "a")
+	require.NoError(t, err)
+
+	releaseA2()
+	releaseB()
+}
+
+func TestAdmissionCancelLeavesQueue(t *testing.T) {
+	pool := admission.NewPool("test", admission.Config{Slots: 1, QueueTimeout: time.Minute})
+
+	release, err := pool.Acquire(context.Background(), "a")
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		_, err := pool.Acquire(ctx, "b")
+		done <- err
+	}()
+
+	cancel()
+	require.Equal(t, codes.Canceled, status.Code(<-done))
+
+	// отмененный вызов не занимает слот после освобождения
+	release()
+	release, err = pool.Acquire(context.Background(), "c")
+	require.NoError(t, err)
+	release()
+}
+
+func TestAdmissionWeightedFairQueuing(t *testing.T) {
+	pool := admission.NewPool("test", admission.Config{
+		Slots:        1,
+		QueueTimeout: time.Minute,
+		Weights:      map[string]int{"heavy": 2},
+	})
+
+	hold, err := pool.Acquire(context.Background(), "holder")
+	require.NoError(t, err)
+
+	var (
+		mu    sync.Mutex
+		order []string
+		wg    sync.WaitGroup
+	)
+	// require в чужой горутине не останавливает тест, ошибки проверяем после Wait
+	errs := make(chan error, 9)
+	enqueue := func(client string) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			release, err := pool.Acquire(context.Background(), client)
+			if err != nil {
+				errs <- err
+				return
+			}
+			mu.Lock()
+			order = append(order, client)
+			mu.Unlock()
+			release()
+		}()
+	}
+
+	// "heavy" ставит в очередь 6 вызовов раньше, чем "light" свои 3
+	for i := 0; i < 6; i++ {
+		enqueue("heavy")
+	}
+	waitQueued(t, pool, 6)
+	for i := 0; i < 3; i++ {
+		enqueue("light")
+	}
+	waitQueued(t, pool, 9)
+
+	hold()
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		require.NoError(t, err)
+	}
+
+	// несмотря на очередность, light получает каждый третий слот
+	require.Len(t, order, 9)
+	for i := 0; i < 9; i += 3 {
+		window := order[i : i+3]
+		require.Contains(t, window, "light", "order: %v", order)
+	}
+}
+
+// waitQueued ждет, пока в очереди пула наберется n вызовов
+func waitQueued(t *testing.T, pool *admission.Pool, n int) {
+	require.Eventually(t, func() bool {
+		return pool.Waiting() == n
+	}, time.Second, time.Millisecond)
+}
@@ -0,0 +1,203 @@
+package tests
+
+import (
+	"Tages/internal/audit"
+	"Tages/internal/clientinfo"
+	"Tages/internal/dto"
+	"Tages/internal/storage"
+	pb "Tages/pkg"
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"net"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+type memAuditStore struct {
+	mu     sync.Mutex
+	events []dto.AuditEvent
+}
+
+func (m *memAuditStore) AddAuditEvents(ctx context.Context, events []dto.AuditEvent) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, ev := range events {
+		ev.ID = int64(len(m.events) + 1)
+		m.events = append(m.events, ev)
+	}
+	return nil
+}
+
+func (m *memAuditStore) QueryAuditEvents(ctx context.Context, filter dto.AuditFilter) ([]dto.AuditEvent, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var out []dto.AuditEvent
+	for _, ev := range m.events {
+		if ev.ID <= filter.AfterID || (filter.Actor != "" && ev.Actor != filter.Actor) {
+			continue
+		}
+		out = append(out, ev)
+		if filter.Limit > 0 && len(out) == filter.Limit {
+			break
+		}
+	}
+	return out, nil
+}
+
+func TestAuditInterceptorRecordsEvent(t *testing.T) {
+	store := &memAuditStore{}
+	trusted, err := clientinfo.ParseCIDRs([]string{"10.0.0.0/8"})
+	require.NoError(t, err)
+	a := audit.New(store, logrus.New(), audit.Config{TrustedProxies: trusted})
+	go a.Run()
+
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs("x-client-id", "alice"))
+	ctx = peer.NewContext(ctx, &peer.Peer{Addr: &net.TCPAddr{IP: net.ParseIP("10.0.0.1"), Port: 5000}})
+
+	info := &grpc.UnaryServerInfo{FullMethod: "/tages.service.FileService/DownloadFileUnary"}
+	_, err = a.UnaryInterceptor()(ctx, nil, info, func(ctx context.Context, req interface{}) (interface{}, error) {
+		audit.Annotate(ctx, "cat.jpg", 42)
+		return nil, status.Error(codes.NotFound, "file not found")
+	})
+	require.Error(t, err)
+
+	a.Close()
+
+	require.Len(t, store.events, 1)
+	ev := store.events[0]
+	require.Equal(t, "alice", ev.Actor)
+	require.Equal(t, "10.0.0.1:5000", ev.Peer)
+	require.Equal(t, info.FullMethod, ev.Method)
+	require.Equal(t, "cat.jpg", ev.FileName)
+	require.Equal(t, int64(42), ev.Bytes)
+	require.Equal(t, codes.NotFound.String(), ev.Code)
+}
+
+func TestAuditActorIgnoresUntrustedClientID(t *testing.T) {
+	store := &memAuditStore{}
+	a := audit.New(store, logrus.New(), audit.Config{})
+	go a.Run()
+
+	// x-client-id не от доверенного прокси - это просто заявление клиента
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs("x-client-id", "alice"))
+	ctx = peer.NewContext(ctx, &peer.Peer{Addr: &net.TCPAddr{IP: net.ParseIP("203.0.113.5"), Port: 5000}})
+
+	info := &grpc.UnaryServerInfo{FullMethod: "/tages.service.FileService/ListFiles"}
+	_, err := a.UnaryInterceptor()(ctx, nil, info, func(ctx context.Context, req interface{}) (interface{}, error) {
+		return nil, nil
+	})
+	require.NoError(t, err)
+	a.Close()
+
+	require.Len(t, store.events, 1)
+	require.Equal(t, clientinfo.Anonymous, store.events[0].Actor)
+}
+
+func TestAuditQueryRequiresAdminToken(t *testing.T) {
+	store := &memAuditStore{}
+	require.NoError(t, store.AddAuditEvents(context.Background(), []dto.AuditEvent{
+		{Actor: "alice", Method: "/m", FileName: "a.txt"},
+		{Actor: "bob", Method: "/m", FileName: "b.txt"},
+	}))
+	req := &pb.AuditQueryRequest{Actor: "bob"}
+
+	_, err := audit.NewServer(store, logrus.New(), "").QueryAuditLog(context.Background(), req)
+	require.Equal(t, codes.PermissionDenied, status.Code(err))
+
+	srv := audit.NewServer(store, logrus.New(), "s3cret")
+	_, err = srv.QueryAuditLog(context.Background(), req)
+	require.Equal(t, codes.Unauthenticated, status.Code(err))
+
+	bad := metadata.NewIncomingContext(context.Background(), metadata.Pairs("x-admin-token", "guess"))
+	_, err = srv.QueryAuditLog(bad, req)
+	require.Equal(t, codes.Unauthenticated, status.Code(err))
+
+	for _, md := range []metadata.MD{
+		metadata.Pairs("x-admin-token", "s3cret"),
+		metadata.Pairs("authorization", "Bearer s3cret"),
+	} {
+		resp, err := srv.QueryAuditLog(metadata.NewIncomingContext(context.Background(), md), req)
+		require.NoError(t, err)
+		require.Len(t, resp.Events, 1)
+		require.Equal(t, "b.txt", resp.Events[0].FileName)
+		require.Equal(t, resp.Events[0].Id, resp.NextAfterId)
+	}
+}
+
+func TestAuditExportJSONL(t *testing.T) {
+	store := &memAuditStore{}
+	for i := 0; i < 3; i++ {
+		require.NoError(t, store.AddAuditEvents(context.Background(), []dto.AuditEvent{{Actor: "bob", Method: "/m"}}))
+	}
+	require.NoError(t, store.AddAuditEvents(context.Background(), []dto.AuditEvent{{Actor: "eve", Method: "/m"}}))
+
+	var buf bytes.Buffer
+	n, err := audit.ExportJSONL(context.Background(), store, dto.AuditFilter{Actor: "bob"}, &buf)
+	require.NoError(t, err)
+	require.Equal(t, 3, n)
+
+	lines := bytes.Split(bytes.TrimSpace(buf.Bytes()), []byte("\n"))
+	require.Len(t, lines, 3)
+	var ev dto.AuditEvent
+	require.NoError(t, json.Unmarshal(lines[0], &ev))
+	require.Equal(t, "bob", ev.Actor)
+}
+
+func TestSQLiteAuditEvents(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tages.db")
+	store, err := storage.NewStorage("sqlite://" + path)
+	require.NoError(t, err)
+	defer store.Close(context.Background())
+	ctx := context.Background()
+	require.NoError(t, store.Init(ctx, logrus.New()))
+
+	base := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	require.NoError(t, store.AddAuditEvents(ctx, []dto.AuditEvent{
+		{OccurredAt: base, Actor: "alice", Method: "/m", Code: "OK"},
+		{OccurredAt: base.Add(time.Hour), Actor: "bob", Method: "/m", FileName: "b.txt", Code: "OK"},
+		// то же время в другой зоне не должно ломать выборку по периоду
+		{OccurredAt: base.Add(2 * time.Hour).In(time.FixedZone("MSK", 3*3600)), Actor: "alice", Method: "/m", Code: "OK"},
+	}))
+
+	got, err := store.QueryAuditEvents(ctx, dto.AuditFilter{From: base.Add(30 * time.Minute), Actor: "alice"})
+	require.NoError(t, err)
+	require.Len(t, got, 1)
+	require.True(t, got[0].OccurredAt.Equal(base.Add(2*time.Hour)))
+
+	// To не включает границу
+	got, err = store.QueryAuditEvents(ctx, dto.AuditFilter{To: base.Add(time.Hour)})
+	require.NoError(t, err)
+	require.Len(t, got, 1)
+	require.Equal(t, "alice", got[0].Actor)
+
+	got, err = store.QueryAuditEvents(ctx, dto.AuditFilter{From: base, To: base.Add(3 * time.Hour), FileName: "b.txt"})
+	require.NoError(t, err)
+	require.Len(t, got, 1)
+	require.Equal(t, "bob", got[0].Actor)
+
+	got, err = store.QueryAuditEvents(ctx, dto.AuditFilter{AfterID: got[0].ID, Limit: 1})
+	require.NoError(t, err)
+	require.Len(t, got, 1)
+	require.True(t, got[0].OccurredAt.Equal(base.Add(2*time.Hour)))
+
+	// журнал только пополняется, даже в обход хранилища
+	db, err := sql.Open("sqlite", path)
+	require.NoError(t, err)
+	defer db.Close()
+	_, err = db.Exec("delete from audit_events")
+	require.ErrorContains(t, err, "append-only")
+	_, err = db.Exec("update audit_events set actor = 'mallory'")
+	require.ErrorContains(t, err, "append-only")
+}
@@ -0,0 +1,175 @@
+package tests
+
+import (
+	"Tages/internal/cache"
+	"Tages/internal/dto"
+	"Tages/internal/service"
+	pb "Tages/pkg"
+	"Tages/pkg/mocks"
+	"context"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/require"
+)
+
+func newRedisCache(t *testing.T, addr string) *cache.RedisCache {
+	c := cache.NewRedisCache(cache.RedisConfig{
+		Addr:            addr,
+		KeyPrefix:       "test:cache:",
+		Timeout:         200 * time.Millisecond,
+		BreakerFailures: 2,
+		BreakerCooldown: 50 * time.Millisecond,
+	}, logrus.New())
+	t.Cleanup(func() { c.Close() })
+	return c
+}
+
+func TestRedisCacheSharedAcrossReplicas(t *testing.T) {
+	mr := miniredis.RunT(t)
+	replicaA := newRedisCache(t, mr.Addr())
+	replicaB := newRedisCache(t, mr.Addr())
+
+	_, ok := replicaB.List(cache.Filter{})
+	require.False(t, ok, "not warmed yet")
+
+	replicaA.Warm(testFiles(3))
+	f := dto.File{ID: uuid.New(), Name: "b.png", Path: "/tmp/b.png", Checksum: "abc"}
+	replicaA.Set(f)
+
+	got, ok := replicaB.Get("b.png")
+	require.True(t, ok)
+	require.Equal(t, f.Path, got.Path)
+	require.Equal(t, f.ID, got.ID)
+
+	files, ok := replicaB.List(cache.Filter{})
+	require.True(t, ok)
+	require.Len(t, files, 4)
+
+	files, ok = replicaB.List(cache.Filter{Prefix: "file", Limit: 2})
+	require.True(t, ok)
+	require.Len(t, files, 2)
+
+	replicaB.Delete("b.png")
+	_, ok = replicaA.Get("b.png")
+	require.False(t, ok)
+
+	replicaA.Invalidate()
+	_, ok = replicaB.List(cache.Filter{})
+	require.False(t, ok)
+}
+
+func TestRedisCacheUnknownRecordVersion(t *testing.T) {
+	mr := miniredis.RunT(t)
+	c := newRedisCache(t, mr.Addr())
+
+	c.Warm(testFiles(1))
+	// запись от реплики с более новым форматом
+	mr.HSet("test:cache:files", "future.png", `{"v":99,"name":"future.png"}`)
+
+	_, ok := c.Get("future.png")
+	require.False(t, ok)
+	_, ok = c.List(cache.Filter{})
+	require.False(t, ok)
+}
+
+func TestRedisCacheBreakerFallsBackToDatabase(t *testing.T) {
+	viper.Set("upload.dir", t.TempDir())
+	logger := logrus.New()
+	mr := miniredis.RunT(t)
+	c := newRedisCache(t, mr.Addr())
+
+	var calls atomic.Int32
+	mockStorage := &mocks.MockStorage{
+		GetAllFilesFn: func(ctx context.Context) ([]dto.File, error) {
+			calls.Add(1)
+			return testFiles(2), nil
+		},
+	}
+	srv, err := service.NewServicefile(context.Background(), logger, c, mockStorage)
+	require.NoError(t, err)
+	require.NoError(t, srv.HeatCache(context.Background()))
+
+	_, err = srv.ListFiles(context.Background(), &pb.ListRequest{})
+	require.NoError(t, err)
+	require.Equal(t, int32(1), calls.Load(), "list served from redis")
+
+	mr.SetError("unavailable")
+	for i := 0; i < 3; i++ {
+		resp, err := srv.ListFiles(context.Background(), &pb.ListRequest{})
+		require.NoError(t, err)
+		require.Len(t, resp.Files, 2)
+	}
+	// пока redis недоступен, загрузка не попала в общий кеш
+	c.Set(dto.File{Name: "lost.png"})
+	mr.SetError("")
+
+	time.Sleep(60 * time.Millisecond)
+	_, ok := c.List(cache.Filter{})
+	require.False(t, ok, "list must be rewarmed after an outage")
+}
+
+func TestRedisCacheDisabled(t *testing.T) {
+	mr := miniredis.RunT(t)
+	replicaA := newRedisCache(t, mr.Addr())
+	replicaB := newRedisCache(t, mr.Addr())
+
+	replicaA.SetEnabled(false)
+	replicaA.Warm(testFiles(2))
+	_, ok := replicaA.List(cache.Filter{})
+	require.False(t, ok)
+
+	replicaB.Warm(testFiles(2))
+	_, ok = replicaA.List(cache.Filter{})
+	require.False(t, ok)
+
+	// выключенная реплика все равно обновляет общий список для остальных
+	replicaA.Set(dto.File{ID: uuid.New(), Name: "new.png"})
+	files, ok := replicaB.List(cache.Filter{})
+	require.True(t, ok)
+	require.Len(t, files, 3)
+}
+
+func TestRedisCacheMaxEntries(t *testing.T) {
+	mr := miniredis.RunT(t)
+	c := newRedisCache(t, mr.Addr())
+	c.SetLimits(cache.Limits{MaxEntries: 3})
+
+	c.Warm(testFiles(4))
+	_, ok := c.List(cache.Filter{})
+	require.False(t, ok, "list over the limit is not cached")
+
+	c.Warm(testFiles(3))
+	_, ok = c.List(cache.Filter{})
+	require.True(t, ok)
+
+	// файл сверх лимита сбрасывает список целиком
+	c.Set(dto.File{ID: uuid.New(), Name: "extra.png"})
+	_, ok = c.List(cache.Filter{})
+	require.False(t, ok)
+	require.False(t, mr.Exists("test:cache:files"))
+}
+
+func TestCheckRedisSettings(t *testing.T) {
+	v := viper.New()
+	v.SetConfigType("yaml")
+	require.NoError(t, v.ReadConfig(strings.NewReader("cache:\n  max_entries: 100\n  redis:\n    addr: localhost:6379\n")))
+	require.NoError(t, cache.CheckRedisSettings(v))
+
+	for _, doc := range []string{
+		"cache:\n  max_bytes: 1024\n",
+		"cache:\n  ttl_ms: 1000\n",
+		"cache:\n  pressure:\n    high_percent: 80\n",
+	} {
+		v := viper.New()
+		v.SetConfigType("yaml")
+		require.NoError(t, v.ReadConfig(strings.NewReader(doc)))
+		require.Error(t, cache.CheckRedisSettings(v), doc)
+	}
+}
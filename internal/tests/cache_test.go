@@ -0,0 +1,291 @@
+package tests
+
+import (
+	"Tages/internal/cache"
+	"Tages/internal/dto"
+	"Tages/internal/service"
+	"Tages/internal/storage"
+	pb "Tages/pkg"
+	"Tages/pkg/mocks"
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/require"
+)
+
+func testFiles(n int) []dto.File {
+	files := make([]dto.File, 0, n)
+	for i := 0; i < n; i++ {
+		files = append(files, dto.File{Name: fmt.Sprintf("file%d", i), Path: fmt.Sprintf("/tmp/file%d", i)})
+	}
+	return files
+}
+
+func TestCacheEvictsLeastRecentlyUsed(t *testing.T) {
+	c := cache.NewCache(logrus.New(), make(chan float64, 1))
+	c.SetLimits(cache.Limits{MaxEntries: 2})
+
+	files := testFiles(3)
+	c.Set(files[0])
+	c.Set(files[1])
+
+	_, ok := c.Get("file0")
+	require.True(t, ok)
+
+	c.Set(files[2])
+
+	_, ok = c.Get("file1")
+	require.False(t, ok, "least recently used entry must be evicted")
+	_, ok = c.Get("file0")
+	require.True(t, ok)
+	_, ok = c.Get("file2")
+	require.True(t, ok)
+}
+
+func TestLoadPressureConfigRejectsInvalid(t *testing.T) {
+	v := viper.New()
+	v.Set("cache.pressure.high_percent", 70)
+	v.Set("cache.pressure.critical_percent", 85)
+	v.Set("cache.pressure.recovery_percent", 60)
+	v.Set("cache.pressure.degraded_ratio", 0.5)
+	v.Set("cache.pressure.sample_interval_ms", 15000)
+	cfg, err := cache.LoadPressureConfig(v)
+	require.NoError(t, err)
+	require.Equal(t, 15*time.Second, cfg.SampleInterval)
+
+	v.Set("cache.pressure.sample_interval_ms", 0)
+	_, err = cache.LoadPressureConfig(v)
+	require.Error(t, err)
+}
+
+func TestCacheMaxBytes(t *testing.T) {
+	c := cache.NewCache(logrus.New(), make(chan float64, 1))
+	c.SetLimits(cache.Limits{MaxBytes: 1024})
+
+	// список больше границ не кладется, иначе каждый ListFiles вытеснял бы все заново
+	c.Warm(testFiles(100))
+	require.Nil(t, c.GetFilesFromCache(), "partial cache must not serve the full list")
+	require.Zero(t, c.Stats().Entries)
+
+	// отдельные записи по-прежнему ограничены объемом
+	for _, f := range testFiles(100) {
+		c.Set(f)
+	}
+	_, ok := c.Get("file99")
+	require.True(t, ok)
+	_, ok = c.Get("file0")
+	require.False(t, ok)
+	require.LessOrEqual(t, c.Stats().Bytes, int64(1024))
+}
+
+func TestCacheTTL(t *testing.T) {
+	c := cache.NewCache(logrus.New(), make(chan float64, 1))
+	c.SetLimits(cache.Limits{TTL: 20 * time.Millisecond})
+
+	c.Warm(testFiles(2))
+	require.Len(t, c.GetFilesFromCache(), 2)
+
+	time.Sleep(40 * time.Millisecond)
+
+	_, ok := c.Get("file0")
+	require.False(t, ok)
+	require.Nil(t, c.GetFilesFromCache())
+}
+
+func TestCacheNotServedBeforeWarm(t *testing.T) {
+	c := cache.NewCache(logrus.New(), make(chan float64, 1))
+
+	c.Set(dto.File{Name: "file0"})
+	require.Nil(t, c.GetFilesFromCache())
+
+	c.SetEnabled(false)
+	c.Warm(testFiles(2))
+	require.Nil(t, c.GetFilesFromCache())
+}
+
+func TestListFilesRewarmsAfterEviction(t *testing.T) {
+	viper.Set("upload.dir", t.TempDir())
+	logger := logrus.New()
+	c := cache.NewCache(logger, make(chan float64, 1))
+
+	calls := 0
+	mockStorage := &mocks.MockStorage{
+		GetAllFilesFn: func(ctx context.Context) ([]dto.File, error) {
+			calls++
+			return testFiles(3), nil
+		},
+	}
+
+	srv, err := service.NewServicefile(context.Background(), logger, c, mockStorage)
+	require.NoError(t, err)
+	require.NoError(t, srv.HeatCache(context.Background()))
+
+	// вытесняем запись, кеш становится неполным
+	c.SetLimits(cache.Limits{MaxEntries: 2})
+	c.SetLimits(cache.Limits{MaxEntries: 10})
+
+	resp, err := srv.ListFiles(context.Background(), &pb.ListRequest{})
+	require.NoError(t, err)
+	require.Len(t, resp.Files, 3)
+	require.Equal(t, 2, calls)
+
+	resp, err = srv.ListFiles(context.Background(), &pb.ListRequest{})
+	require.NoError(t, err)
+	require.Len(t, resp.Files, 3)
+	require.Equal(t, 2, calls, "list must be served from the rewarmed cache")
+}
+
+func TestListFilesJustOverCacheLimit(t *testing.T) {
+	viper.Set("upload.dir", t.TempDir())
+	logger := logrus.New()
+	c := cache.NewCache(logger, make(chan float64, 1))
+	c.SetLimits(cache.Limits{MaxEntries: 3})
+
+	files := testFiles(3)
+	calls := 0
+	mockStorage := &mocks.MockStorage{
+		GetAllFilesFn: func(ctx context.Context) ([]dto.File, error) {
+			calls++
+			return files, nil
+		},
+	}
+	srv, err := service.NewServicefile(context.Background(), logger, c, mockStorage)
+	require.NoError(t, err)
+	require.NoError(t, srv.HeatCache(context.Background()))
+
+	// четвертый файл не помещается: вытесняется самый давний, список неполный
+	extra := dto.File{Name: "extra", Path: "/tmp/extra"}
+	files = append(files, extra)
+	c.Set(extra)
+
+	for i := 0; i < 3; i++ {
+		resp, err := srv.ListFiles(context.Background(), &pb.ListRequest{})
+		require.NoError(t, err)
+		require.Len(t, resp.Files, 4)
+	}
+	require.Equal(t, 4, calls)
+
+	// список сверх лимита не прогревается и не выталкивает свежие записи
+	_, ok := c.Get("extra")
+	require.True(t, ok)
+	require.Equal(t, 3, c.Stats().Entries)
+	require.False(t, c.Stats().Complete)
+
+	// как только файлы снова помещаются, список опять отдается из кеша
+	files = files[1:]
+	srv.ApplyFileEvent(context.Background(), storage.FileEvent{Op: storage.FileEventDelete, Name: "file0"})
+	resp, err := srv.ListFiles(context.Background(), &pb.ListRequest{})
+	require.NoError(t, err)
+	require.Len(t, resp.Files, 3)
+	require.Equal(t, 5, calls)
+
+	resp, err = srv.ListFiles(context.Background(), &pb.ListRequest{})
+	require.NoError(t, err)
+	require.Len(t, resp.Files, 3)
+	require.Equal(t, 5, calls, "list must hit the cache")
+}
+
+func TestCachePressureStates(t *testing.T) {
+	c := cache.NewCache(logrus.New(), make(chan float64, 1))
+	c.SetPressureConfig(cache.PressureConfig{
+		HighPercent:     70,
+		CriticalPercent: 85,
+		RecoveryPercent: 60,
+		Cooldown:        50 * time.Millisecond,
+		DegradedRatio:   0.5,
+	})
+	c.Warm(testFiles(10))
+
+	c.Observe(75)
+	require.Equal(t, cache.StateDegraded, c.State())
+	require.Nil(t, c.GetFilesFromCache(), "degraded cache keeps only part of the list")
+	_, ok := c.Get("file9")
+	require.True(t, ok)
+	_, ok = c.Get("file0")
+	require.False(t, ok)
+
+	c.Observe(90)
+	require.Equal(t, cache.StateDisabled, c.State())
+	_, ok = c.Get("file9")
+	require.False(t, ok)
+	c.Set(dto.File{Name: "new"})
+	_, ok = c.Get("new")
+	require.False(t, ok)
+
+	// выше порога восстановления кеш остается выключенным
+	c.Observe(65)
+	require.Equal(t, cache.StateDisabled, c.State())
+
+	c.Observe(50)
+	require.Equal(t, cache.StateDisabled, c.State(), "recovery waits for the cooldown")
+
+	time.Sleep(60 * time.Millisecond)
+	c.Observe(50)
+	require.Equal(t, cache.StateEnabled, c.State())
+}
+
+func TestCacheCooldownResetsOnSpike(t *testing.T) {
+	c := cache.NewCache(logrus.New(), make(chan float64, 1))
+	c.SetPressureConfig(cache.PressureConfig{
+		HighPercent:     70,
+		CriticalPercent: 85,
+		RecoveryPercent: 60,
+		Cooldown:        50 * time.Millisecond,
+		DegradedRatio:   0.5,
+	})
+
+	c.Observe(90)
+	c.Observe(50)
+	time.Sleep(30 * time.Millisecond)
+	c.Observe(65)
+	time.Sleep(30 * time.Millisecond)
+	c.Observe(50)
+	require.Equal(t, cache.StateDisabled, c.State())
+}
+
+func TestCacheRewarmsAfterRecovery(t *testing.T) {
+	viper.Set("upload.dir", t.TempDir())
+	logger := logrus.New()
+	detector := make(chan float64, 1)
+	c := cache.NewCache(logger, detector)
+	c.SetPressureConfig(cache.PressureConfig{
+		HighPercent:     70,
+		CriticalPercent: 85,
+		RecoveryPercent: 60,
+		DegradedRatio:   0.5,
+	})
+
+	mockStorage := &mocks.MockStorage{
+		GetAllFilesFn: func(ctx context.Context) ([]dto.File, error) {
+			return testFiles(3), nil
+		},
+	}
+	srv, err := service.NewServicefile(context.Background(), logger, c, mockStorage)
+	require.NoError(t, err)
+	require.NoError(t, srv.HeatCache(context.Background()))
+
+	warmed := make(chan struct{}, 1)
+	c.OnRecover(func() {
+		require.NoError(t, srv.HeatCache(context.Background()))
+		warmed <- struct{}{}
+	})
+
+	go c.RunWatcher()
+	defer close(detector)
+
+	detector <- 95
+	require.Eventually(t, func() bool { return c.State() == cache.StateDisabled }, time.Second, 5*time.Millisecond)
+	detector <- 40
+
+	select {
+	case <-warmed:
+	case <-time.After(time.Second):
+		t.Fatal("cache was not rewarmed")
+	}
+	require.Equal(t, cache.StateEnabled, c.State())
+	require.Len(t, c.GetFilesFromCache(), 3)
+}
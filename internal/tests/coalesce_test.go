@@ -0,0 +1,167 @@
+package tests
+
+import (
+	"Tages/internal/cache"
+	"Tages/internal/coalesce"
+	"Tages/internal/dto"
+	"Tages/internal/service"
+	pb "Tages/pkg"
+	"Tages/pkg/mocks"
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCoalesceSingleCall(t *testing.T) {
+	g := coalesce.New[int]("test", 0)
+
+	var calls atomic.Int32
+	release := make(chan struct{})
+	fn := func(ctx context.Context) (int, error) {
+		calls.Add(1)
+		<-release
+		return 42, nil
+	}
+
+	var wg sync.WaitGroup
+	results := make([]int, 10)
+	for i := range results {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			v, err := g.Do(context.Background(), "k", fn)
+			require.NoError(t, err)
+			results[i] = v
+		}()
+	}
+
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	require.Equal(t, int32(1), calls.Load())
+	for _, v := range results {
+		require.Equal(t, 42, v)
+	}
+}
+
+func TestCoalesceLeaderCancelDoesNotFailWaiters(t *testing.T) {
+	g := coalesce.New[int]("test", 0)
+
+	release := make(chan struct{})
+	fn := func(ctx context.Context) (int, error) {
+		<-release
+		return 7, ctx.Err()
+	}
+
+	leaderCtx, cancel := context.WithCancel(context.Background())
+	leaderErr := make(chan error, 1)
+	go func() {
+		_, err := g.Do(leaderCtx, "k", fn)
+		leaderErr <- err
+	}()
+	time.Sleep(10 * time.Millisecond)
+
+	waiter := make(chan int, 1)
+	go func() {
+		v, err := g.Do(context.Background(), "k", fn)
+		require.NoError(t, err)
+		waiter <- v
+	}()
+	time.Sleep(10 * time.Millisecond)
+
+	cancel()
+	require.ErrorIs(t, <-leaderErr, context.Canceled)
+
+	close(release)
+	require.Equal(t, 7, <-waiter)
+}
+
+func TestCoalesceRecentResult(t *testing.T) {
+	g := coalesce.New[int]("test", time.Minute)
+
+	var calls atomic.Int32
+	fn := func(ctx context.Context) (int, error) {
+		return int(calls.Add(1)), nil
+	}
+
+	v, _ := g.Do(context.Background(), "k", fn)
+	require.Equal(t, 1, v)
+	v, _ = g.Do(context.Background(), "k", fn)
+	require.Equal(t, 1, v, "fresh result must be reused")
+
+	g.Forget("k")
+	v, _ = g.Do(context.Background(), "k", fn)
+	require.Equal(t, 2, v)
+}
+
+func TestCoalesceForgetDuringFlightSkipsStore(t *testing.T) {
+	g := coalesce.New[int]("test", time.Minute)
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	stale := make(chan int, 1)
+	go func() {
+		v, _ := g.Do(context.Background(), "k", func(ctx context.Context) (int, error) {
+			close(started)
+			<-release
+			return 1, nil
+		})
+		stale <- v
+	}()
+
+	<-started
+	// данные поменялись, пока первый вызов читал старые
+	g.Forget("k")
+	close(release)
+	require.Equal(t, 1, <-stale)
+
+	v, err := g.Do(context.Background(), "k", func(ctx context.Context) (int, error) {
+		return 2, nil
+	})
+	require.NoError(t, err)
+	require.Equal(t, 2, v, "result started before Forget must not be reused")
+}
+
+func TestListFilesCoalescesStorageCalls(t *testing.T) {
+	viper.Set("upload.dir", t.TempDir())
+	logger := logrus.New()
+
+	var calls atomic.Int32
+	release := make(chan struct{})
+	mockStorage := &mocks.MockStorage{
+		GetAllFilesFn: func(ctx context.Context) ([]dto.File, error) {
+			calls.Add(1)
+			<-release
+			return testFiles(3), nil
+		},
+	}
+
+	c := cache.NewCache(logger, make(chan float64, 1))
+	c.SetEnabled(false)
+	srv, err := service.NewServicefile(context.Background(), logger, c, mockStorage)
+	require.NoError(t, err)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			resp, err := srv.ListFiles(context.Background(), &pb.ListRequest{})
+			require.NoError(t, err)
+			require.Len(t, resp.Files, 3)
+		}()
+	}
+
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	require.Equal(t, int32(1), calls.Load())
+}
@@ -0,0 +1,92 @@
+package tests
+
+import (
+	"Tages/internal/config"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/require"
+)
+
+func newReloaderWithFile(t *testing.T, content string) (*config.Reloader, *viper.Viper, string, *atomic.Int64) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(content), 0644))
+
+	v := viper.New()
+	v.SetConfigFile(path)
+	require.NoError(t, v.ReadInConfig())
+
+	limit := &atomic.Int64{}
+	r := config.NewReloader(v, nil, logrus.New())
+	r.Subscribe("upload", func(v *viper.Viper) (func(), error) {
+		size := v.GetInt64("upload.max_file_size")
+		if size <= 0 {
+			return nil, errors.New("upload.max_file_size must be positive")
+		}
+		return func() { limit.Store(size) }, nil
+	})
+	return r, v, path, limit
+}
+
+func TestReloaderAppliesValidChange(t *testing.T) {
+	r, _, path, limit := newReloaderWithFile(t, "upload:\n  max_file_size: 100\n")
+	require.NoError(t, r.Reload())
+	_, hashBefore := r.Applied()
+	require.Equal(t, int64(100), limit.Load())
+
+	require.NoError(t, os.WriteFile(path, []byte("upload:\n  max_file_size: 200\n"), 0644))
+	require.NoError(t, r.Reload())
+
+	_, hashAfter := r.Applied()
+	require.Equal(t, int64(200), limit.Load())
+	require.NotEqual(t, hashBefore, hashAfter)
+}
+
+func TestReloaderRejectsInvalidChange(t *testing.T) {
+	r, _, path, limit := newReloaderWithFile(t, "upload:\n  max_file_size: 100\n")
+	require.NoError(t, r.Reload())
+	_, hashBefore := r.Applied()
+
+	require.NoError(t, os.WriteFile(path, []byte("upload:\n  max_file_size: -1\n"), 0644))
+	require.Error(t, r.Reload())
+
+	settings, hashAfter := r.Applied()
+	require.Equal(t, int64(100), limit.Load())
+	require.Equal(t, hashBefore, hashAfter)
+	require.EqualValues(t, 100, settings["upload"].(map[string]interface{})["max_file_size"])
+}
+
+func TestReloaderWatchesFile(t *testing.T) {
+	r, _, path, limit := newReloaderWithFile(t, "upload:\n  max_file_size: 100\n")
+	r.Start()
+
+	require.NoError(t, os.WriteFile(path, []byte("upload:\n  max_file_size: 300\n"), 0644))
+	require.Eventually(t, func() bool {
+		return limit.Load() == 300
+	}, 5*time.Second, 20*time.Millisecond)
+}
+
+func TestReloaderKeepsRejectedAndStaticValuesOutOfActiveConfig(t *testing.T) {
+	r, v, path, limit := newReloaderWithFile(t, "upload:\n  max_file_size: 100\nshutdown:\n  drain_timeout_ms: 1000\n")
+	r.Static("shutdown")
+	require.NoError(t, r.Reload())
+
+	// отклоненный файл не виден тем, кто читает v напрямую
+	require.NoError(t, os.WriteFile(path, []byte("upload:\n  max_file_size: -1\nshutdown:\n  drain_timeout_ms: 5\n"), 0644))
+	require.Error(t, r.Reload())
+	require.EqualValues(t, 100, v.GetInt64("upload.max_file_size"))
+	require.EqualValues(t, 1000, v.GetInt("shutdown.drain_timeout_ms"))
+
+	// принятый файл меняет v, кроме Static ключей
+	require.NoError(t, os.WriteFile(path, []byte("upload:\n  max_file_size: 200\nshutdown:\n  drain_timeout_ms: 5\n"), 0644))
+	require.NoError(t, r.Reload())
+	require.Equal(t, int64(200), limit.Load())
+	require.EqualValues(t, 200, v.GetInt64("upload.max_file_size"))
+	require.EqualValues(t, 1000, v.GetInt("shutdown.drain_timeout_ms"))
+}
@@ -0,0 +1,149 @@
+package tests
+
+import (
+	"Tages/internal/cache"
+	"Tages/internal/dto"
+	"Tages/internal/service"
+	"Tages/internal/storage"
+	pb "Tages/pkg"
+	"Tages/pkg/mocks"
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/require"
+)
+
+func TestContentCacheBudget(t *testing.T) {
+	c := cache.NewContentCache(cache.ContentLimits{MaxBytes: 10, MaxFileSize: 6})
+	a, b := uuid.New(), uuid.New()
+
+	c.Put(a, "a", []byte("aaaaa"))
+	c.Put(b, "b", []byte("bbbbb"))
+	_, ok := c.Get(a, "a")
+	require.True(t, ok)
+
+	// не влезает в бюджет, вытесняется самая давняя запись
+	c.Put(uuid.New(), "c", []byte("ccccc"))
+	_, ok = c.Get(b, "b")
+	require.False(t, ok)
+	_, ok = c.Get(a, "a")
+	require.True(t, ok)
+
+	c.Put(uuid.New(), "big", []byte("toolarge"))
+	require.False(t, c.Cacheable(8))
+}
+
+func TestContentCacheInvalidate(t *testing.T) {
+	c := cache.NewContentCache(cache.DefaultContentLimits)
+	id := uuid.New()
+
+	c.Put(id, "v1", []byte("old"))
+	_, ok := c.Get(id, "v2")
+	require.False(t, ok, "other checksum must miss")
+
+	c.Put(id, "v2", []byte("new"))
+	_, ok = c.Get(id, "v1")
+	require.False(t, ok, "new version replaces the old one")
+
+	c.Invalidate(id)
+	_, ok = c.Get(id, "v2")
+	require.False(t, ok)
+}
+
+func TestDownloadServedFromContentCache(t *testing.T) {
+	viper.Set("upload.dir", t.TempDir())
+	viper.Set("cache.content.max_bytes", cache.DefaultContentLimits.MaxBytes)
+	viper.Set("cache.content.max_file_size", cache.DefaultContentLimits.MaxFileSize)
+	logger := logrus.New()
+
+	var mu sync.Mutex
+	files := map[string]dto.File{}
+	mockStorage := &mocks.MockStorage{
+		AddFileFn: func(ctx context.Context, f dto.File) error {
+			mu.Lock()
+			files[f.Name] = f
+			mu.Unlock()
+			return nil
+		},
+		GetFileByNameFn: func(ctx context.Context, name string) (dto.File, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			f, ok := files[name]
+			if !ok {
+				return dto.File{}, storage.ErrNotFound
+			}
+			return f, nil
+		},
+	}
+
+	// метаданные берутся из БД, а не из кеша
+	c := cache.NewCache(logger, make(chan float64, 1))
+	c.SetEnabled(false)
+	srv, err := service.NewServicefile(context.Background(), logger, c, mockStorage)
+	require.NoError(t, err)
+
+	content := []byte("thumbnail")
+	up, err := srv.UploadFileUnary(context.Background(), &pb.UploadRequest{Filename: "thumb.png", Data: content})
+	require.NoError(t, err)
+	name := filepath.Base(up.Path)
+
+	resp, err := srv.DownloadFileUnary(context.Background(), &pb.DownloadRequest{Filename: name})
+	require.NoError(t, err)
+	require.Equal(t, content, resp.Data)
+
+	// файл остался только в памяти
+	require.NoError(t, os.Remove(up.Path))
+
+	resp, err = srv.DownloadFileUnary(context.Background(), &pb.DownloadRequest{Filename: name})
+	require.NoError(t, err)
+	require.Equal(t, content, resp.Data)
+
+	stream := &mockDownloadStream{}
+	require.NoError(t, srv.DownloadFileStream(&pb.DownloadRequest{Filename: name}, stream))
+	var got [][]byte
+	for _, s := range stream.sent {
+		got = append(got, s.Data)
+	}
+	require.Equal(t, content, bytes.Join(got, nil))
+}
+
+func TestDownloadSkipsLookupWhenContentCacheDisabled(t *testing.T) {
+	dir := t.TempDir()
+	viper.Set("upload.dir", dir)
+	logger := logrus.New()
+
+	var lookups atomic.Int32
+	mockStorage := &mocks.MockStorage{
+		GetFileByNameFn: func(ctx context.Context, name string) (dto.File, error) {
+			lookups.Add(1)
+			return dto.File{}, storage.ErrNotFound
+		},
+	}
+	c := cache.NewCache(logger, make(chan float64, 1))
+	c.SetEnabled(false)
+	srv, err := service.NewServicefile(context.Background(), logger, c, mockStorage)
+	require.NoError(t, err)
+	srv.SetContentLimits(cache.ContentLimits{})
+
+	content := []byte("thumbnail")
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "thumb.png"), content, 0644))
+
+	resp, err := srv.DownloadFileUnary(context.Background(), &pb.DownloadRequest{Filename: "thumb.png"})
+	require.NoError(t, err)
+	require.Equal(t, content, resp.Data)
+
+	stream := &mockDownloadStream{}
+	require.NoError(t, srv.DownloadFileStream(&pb.DownloadRequest{Filename: "thumb.png"}, stream))
+	require.Len(t, stream.sent, 1)
+	require.Equal(t, content, stream.sent[0].Data)
+
+	require.Zero(t, lookups.Load())
+}
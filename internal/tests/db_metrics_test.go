@@ -0,0 +1,95 @@
+package tests
+
+import (
+	"Tages/internal/metrics"
+	"Tages/internal/storage"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDBQueryMetrics(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	store, err := storage.NewStorageWithDB(db)
+	require.NoError(t, err)
+
+	okBefore := testutil.ToFloat64(metrics.DBQueries.WithLabelValues("query", "files", "success"))
+	missBefore := testutil.ToFloat64(metrics.DBQueries.WithLabelValues("query", "files", "not_found"))
+	errBefore := testutil.ToFloat64(metrics.DBQueries.WithLabelValues("query", "files", "error"))
+
+	mock.ExpectQuery(`SELECT \* FROM "files"`).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "name"}).AddRow("5f0c7d7e-1b7a-4c1e-9c2e-0c1f2e3d4b5a", "a.txt"))
+	_, err = store.GetAllFiles(context.Background())
+	require.NoError(t, err)
+
+	mock.ExpectQuery(`SELECT \* FROM "files" WHERE name = `).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "name"}))
+	_, err = store.GetFileByName(context.Background(), "missing.txt")
+	require.ErrorIs(t, err, storage.ErrNotFound)
+
+	mock.ExpectQuery(`SELECT \* FROM "files"`).WillReturnError(sqlmock.ErrCancelled)
+	_, err = store.GetAllFiles(context.Background())
+	require.Error(t, err)
+
+	require.NoError(t, mock.ExpectationsWereMet())
+	require.Equal(t, okBefore+1, testutil.ToFloat64(metrics.DBQueries.WithLabelValues("query", "files", "success")))
+	require.Equal(t, missBefore+1, testutil.ToFloat64(metrics.DBQueries.WithLabelValues("query", "files", "not_found")))
+	require.Equal(t, errBefore+1, testutil.ToFloat64(metrics.DBQueries.WithLabelValues("query", "files", "error")))
+
+	reg := prometheus.NewRegistry()
+	require.NoError(t, store.RegisterMetrics(reg))
+	families, err := reg.Gather()
+	require.NoError(t, err)
+	require.Contains(t, familyNames(families), "go_sql_open_connections")
+}
+
+func TestLegacyMetricNames(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	metrics.Initalize(reg)
+	metrics.RegisterLegacy(reg)
+
+	metrics.DBMetricsFunc("success", "add_file", time.Now())
+
+	families, err := reg.Gather()
+	require.NoError(t, err)
+	names := familyNames(families)
+
+	for _, name := range []string{
+		"apps_storage_operations_total",
+		"apps_image_operation_total_db",
+		"apps_image_operation_db_duration_seconds",
+		"backend_runtime_gc_totak_time_seconds",
+		"backend_runtime_go_memstats_alloc_bytes",
+		"go_goroutines",
+		"go_memstats_alloc_bytes",
+	} {
+		require.Contains(t, names, name)
+	}
+
+	// без legacy_metrics старых имен нет
+	reg = prometheus.NewRegistry()
+	metrics.Initalize(reg)
+	families, err = reg.Gather()
+	require.NoError(t, err)
+	for name := range familyNames(families) {
+		require.NotContains(t, name, "apps_image_")
+		require.NotContains(t, name, "backend_runtime_")
+	}
+}
+
+func familyNames(families []*dto.MetricFamily) map[string]bool {
+	names := make(map[string]bool, len(families))
+	for _, f := range families {
+		names[f.GetName()] = true
+	}
+	return names
+}
@@ -27,6 +27,10 @@ func (m *mockDownloadStream) Send(resp *pb.DownloadResponse) error {
 	return nil
 }
 
+func (m *mockDownloadStream) Context() context.Context {
+	return context.Background()
+}
+
 func TestDownloadFileStream(t *testing.T) {
 	dir := t.TempDir()
 	viper.Set("upload.dir", dir)
@@ -37,7 +41,7 @@ func TestDownloadFileStream(t *testing.T) {
 	require.NoError(t, err)
 
 	logger := logrus.New()
-	c := cache.NewCache(logger, make(chan bool, 1))
+	c := cache.NewCache(logger, make(chan float64, 1))
 	mockStorage := &mocks.MockStorage{}
 	srv, _ := service.NewServicefile(context.Background(), logger, c, mockStorage)
 
@@ -0,0 +1,134 @@
+package tests
+
+import (
+	"Tages/internal/cache"
+	"Tages/internal/drain"
+	"Tages/internal/dto"
+	"Tages/internal/service"
+	pb "Tages/pkg"
+	"Tages/pkg/mocks"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// blockingUploadStream отдает один чанк и ждет, пока соединение не закроют
+type blockingUploadStream struct {
+	grpc.ServerStream
+	ctx  context.Context
+	sent bool
+}
+
+func (m *blockingUploadStream) Recv() (*pb.UploadRequest, error) {
+	if !m.sent {
+		m.sent = true
+		return &pb.UploadRequest{Filename: "big.bin", Data: []byte("partial")}, nil
+	}
+	<-m.ctx.Done()
+	return nil, status.FromContextError(m.ctx.Err()).Err()
+}
+
+func (m *blockingUploadStream) SendAndClose(*pb.UploadResponse) error {
+	return nil
+}
+
+func (m *blockingUploadStream) Context() context.Context {
+	return m.ctx
+}
+
+func TestDrainCancelsUploadAndRemovesPartialFile(t *testing.T) {
+	dir := t.TempDir()
+	viper.Set("upload.dir", dir)
+
+	logger := logrus.New()
+	c := cache.NewCache(logger, make(chan float64, 1))
+	mockStorage := &mocks.MockStorage{
+		AddFileFn: func(ctx context.Context, f dto.File) error { return nil },
+		WithInTransactionFn: func(ctx context.Context, fn func(context.Context) error) error {
+			return fn(ctx)
+		},
+	}
+	srv, err := service.NewServicefile(context.Background(), logger, c, mockStorage)
+	require.NoError(t, err)
+	transfers := srv.Transfers()
+
+	// закрытие соединения сервером, как grpc.Server.Stop
+	connCtx, closeConn := context.WithCancel(context.Background())
+	defer closeConn()
+
+	done := make(chan error, 1)
+	go func() {
+		done <- srv.UploadFileStream(&blockingUploadStream{ctx: connCtx})
+	}()
+
+	require.Eventually(t, func() bool {
+		entries, _ := os.ReadDir(dir)
+		return len(entries) == 1
+	}, time.Second, 10*time.Millisecond)
+	require.Equal(t, 1, transfers.Active())
+
+	transfers.Drain()
+
+	// новые передачи отклоняются
+	_, err = srv.DownloadFileUnary(context.Background(), &pb.DownloadRequest{Filename: "x"})
+	require.Equal(t, codes.Unavailable, status.Code(err))
+
+	// идущая передача не укладывается в срок
+	waitCtx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	require.ErrorIs(t, transfers.Wait(waitCtx), context.DeadlineExceeded)
+
+	transfers.Cancel()
+	closeConn()
+
+	require.Error(t, <-done)
+	require.NoError(t, transfers.Wait(context.Background()))
+	require.Equal(t, 0, transfers.Active())
+
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	require.Empty(t, entries)
+}
+
+func TestDrainCleanupKeepsCommittedFiles(t *testing.T) {
+	dir := t.TempDir()
+	tracker := drain.New(logrus.New())
+
+	partial := filepath.Join(dir, "partial")
+	saved := filepath.Join(dir, "saved")
+	require.NoError(t, os.WriteFile(partial, []byte("a"), 0644))
+	require.NoError(t, os.WriteFile(saved, []byte("b"), 0644))
+
+	op1, _, err := tracker.Begin(context.Background(), "upload")
+	require.NoError(t, err)
+	op1.Track(partial)
+
+	op2, _, err := tracker.Begin(context.Background(), "upload")
+	require.NoError(t, err)
+	op2.Track(saved)
+	op2.Commit()
+
+	// обработчики зависли, файлы удаляет остановка
+	require.Equal(t, 1, tracker.Cleanup())
+	require.NoFileExists(t, partial)
+	require.FileExists(t, saved)
+
+	// повторный Done не трогает файлы и снимает передачи с учета
+	op1.Done()
+	op2.Done()
+	require.Equal(t, 0, tracker.Active())
+	require.NoError(t, tracker.Wait(context.Background()))
+
+	tracker.Drain()
+	_, _, err = tracker.Begin(context.Background(), "download")
+	require.ErrorIs(t, err, drain.ErrDraining)
+}
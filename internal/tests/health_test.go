@@ -0,0 +1,148 @@
+package tests
+
+import (
+	"Tages/internal/cache"
+	"Tages/internal/dto"
+	"Tages/internal/health"
+	"Tages/internal/service"
+	"Tages/internal/storage"
+	"Tages/pkg/mocks"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+func healthStatus(t *testing.T, c *health.Checker, svc string) healthpb.HealthCheckResponse_ServingStatus {
+	resp, err := c.Server().Check(context.Background(), &healthpb.HealthCheckRequest{Service: svc})
+	require.NoError(t, err)
+	return resp.Status
+}
+
+func TestHealthReadiness(t *testing.T) {
+	logger := logrus.New()
+	c := health.New(logger, time.Second, "tages.service.FileService")
+
+	warm := health.NewFlag("cache warm-up")
+	c.Add("upload_dir", health.DirWritable(t.TempDir()))
+	c.Add("cache", warm.Check)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go c.Run(ctx, 10*time.Millisecond)
+
+	// пока кеш не прогрет - не готов
+	rec := httptest.NewRecorder()
+	c.ReadyHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	require.Equal(t, http.StatusServiceUnavailable, rec.Code)
+
+	var report map[string]string
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &report))
+	require.Equal(t, "ok", report["upload_dir"])
+	require.NotEqual(t, "ok", report["cache"])
+	require.Equal(t, healthpb.HealthCheckResponse_NOT_SERVING, healthStatus(t, c, "tages.service.FileService"))
+
+	warm.Set()
+	require.Eventually(t, func() bool {
+		return healthStatus(t, c, "tages.service.FileService") == healthpb.HealthCheckResponse_SERVING
+	}, time.Second, 10*time.Millisecond)
+	require.Equal(t, healthpb.HealthCheckResponse_SERVING, healthStatus(t, c, ""))
+
+	rec = httptest.NewRecorder()
+	c.ReadyHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	// после Shutdown статус больше не возвращается в SERVING
+	c.Shutdown()
+	require.Equal(t, healthpb.HealthCheckResponse_NOT_SERVING, healthStatus(t, c, ""))
+	time.Sleep(30 * time.Millisecond)
+	require.Equal(t, healthpb.HealthCheckResponse_NOT_SERVING, healthStatus(t, c, "tages.service.FileService"))
+
+	rec = httptest.NewRecorder()
+	c.ReadyHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	require.Equal(t, http.StatusServiceUnavailable, rec.Code)
+
+	// liveness не зависит от готовности
+	rec = httptest.NewRecorder()
+	c.LiveHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+}
+
+func TestHealthChecks(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, health.DirWritable(dir)(context.Background()))
+	require.Error(t, health.DirWritable(dir+"/missing")(context.Background()))
+
+	require.NoError(t, health.FreeDisk(dir, 1)(context.Background()))
+	require.Error(t, health.FreeDisk(dir, 1<<62)(context.Background()))
+}
+
+func TestHealthConfig(t *testing.T) {
+	v := viper.New()
+	v.Set("health.interval_ms", 5000)
+	v.Set("health.timeout_ms", 2000)
+	v.Set("health.min_free_bytes", 1024)
+	cfg, err := health.LoadConfig(v)
+	require.NoError(t, err)
+	require.Equal(t, 5*time.Second, cfg.Interval)
+	require.Equal(t, uint64(1024), cfg.MinFreeBytes)
+
+	// нулевой интервал уронил бы time.NewTicker
+	for _, interval := range []int{0, -1} {
+		v.Set("health.interval_ms", interval)
+		_, err = health.LoadConfig(v)
+		require.Error(t, err)
+	}
+}
+
+func TestHealthSkipInterceptor(t *testing.T) {
+	called := 0
+	counting := func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		called++
+		return handler(ctx, req)
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) { return nil, nil }
+	wrapped := health.SkipUnary(counting)
+
+	_, err := wrapped(context.Background(), nil, &grpc.UnaryServerInfo{FullMethod: "/grpc.health.v1.Health/Check"}, handler)
+	require.NoError(t, err)
+	require.Equal(t, 0, called)
+
+	_, err = wrapped(context.Background(), nil, &grpc.UnaryServerInfo{FullMethod: "/tages.service.FileService/ListFiles"}, handler)
+	require.NoError(t, err)
+	require.Equal(t, 1, called)
+}
+
+func TestHeatCacheEmptyTable(t *testing.T) {
+	viper.Set("upload.dir", t.TempDir())
+	logger := logrus.New()
+	c := cache.NewCache(logger, make(chan float64, 1))
+
+	mockStorage := &mocks.MockStorage{
+		GetAllFilesFn: func(ctx context.Context) ([]dto.File, error) {
+			return nil, storage.ErrNotFound
+		},
+	}
+	srv, err := service.NewServicefile(context.Background(), logger, c, mockStorage)
+	require.NoError(t, err)
+
+	// пустая таблица не мешает готовности
+	require.NoError(t, srv.HeatCache(context.Background()))
+	files, ok := c.List(cache.Filter{})
+	require.True(t, ok)
+	require.Empty(t, files)
+
+	mockStorage.GetAllFilesFn = func(ctx context.Context) ([]dto.File, error) {
+		return nil, errors.New("db down")
+	}
+	require.Error(t, srv.HeatCache(context.Background()))
+}
@@ -4,7 +4,6 @@ import (
 	"Tages/internal/cache"
 	"Tages/internal/dto"
 	"Tages/internal/service"
-	"Tages/pkg/mocks"
 	"context"
 	"testing"
 
@@ -14,20 +13,17 @@ import (
 
 func TestHeatCache(t *testing.T) {
 	logger := logrus.New()
-	c := cache.NewCache(logger, make(chan bool, 1))
+	c := cache.NewCache(logger, make(chan float64, 1))
 
-	files := []dto.File{
+	store := newSQLiteStorage(t)
+	for _, f := range []dto.File{
 		{Name: "file1", Path: "/tmp/file1"},
 		{Name: "file2", Path: "/tmp/file2"},
+	} {
+		require.NoError(t, store.AddFile(context.Background(), f))
 	}
 
-	mockStorage := &mocks.MockStorage{
-		GetAllFilesFn: func(ctx context.Context) ([]dto.File, error) {
-			return files, nil
-		},
-	}
-
-	srv, _ := service.NewServicefile(context.Background(), logger, c, mockStorage)
+	srv, _ := service.NewServicefile(context.Background(), logger, c, store)
 
 	err := srv.HeatCache(context.Background())
 	require.NoError(t, err)
@@ -0,0 +1,114 @@
+package tests
+
+import (
+	"Tages/internal/storage"
+	"context"
+	"regexp"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadMigrationsOrdered(t *testing.T) {
+	fsys := fstest.MapFS{
+		"m/0002_b.up.sql":   {Data: []byte("create table b()")},
+		"m/0002_b.down.sql": {Data: []byte("drop table b")},
+		"m/0001_a.up.sql":   {Data: []byte("create table a()")},
+		"m/0001_a.down.sql": {Data: []byte("drop table a")},
+	}
+
+	migrations, err := storage.LoadMigrations(fsys, "m")
+	require.NoError(t, err)
+	require.Len(t, migrations, 2)
+	require.Equal(t, int64(1), migrations[0].Version)
+	require.Equal(t, "a", migrations[0].Name)
+	require.Equal(t, "drop table a", migrations[0].Down)
+	require.Equal(t, int64(2), migrations[1].Version)
+}
+
+func TestLoadMigrationsRejectsBrokenSet(t *testing.T) {
+	cases := map[string]fstest.MapFS{
+		"missing down": {
+			"m/0001_a.up.sql": {Data: []byte("select 1")},
+		},
+		"bad name": {
+			"m/init.sql": {Data: []byte("select 1")},
+		},
+		"two names": {
+			"m/0001_a.up.sql":   {Data: []byte("select 1")},
+			"m/0001_b.down.sql": {Data: []byte("select 1")},
+		},
+	}
+	for name, fsys := range cases {
+		t.Run(name, func(t *testing.T) {
+			_, err := storage.LoadMigrations(fsys, "m")
+			require.Error(t, err)
+		})
+	}
+}
+
+func TestEmbeddedMigrations(t *testing.T) {
+	store, _ := newMockStorage(t)
+
+	m, err := store.Migrator(logrus.New())
+	require.NoError(t, err)
+	require.Equal(t, int64(3), m.Latest())
+}
+
+func TestMigrateRefusesSchemaAhead(t *testing.T) {
+	store, mock := newMockStorage(t)
+	m, err := store.Migrator(logrus.New())
+	require.NoError(t, err)
+
+	mock.ExpectExec(regexp.QuoteMeta("select pg_advisory_lock")).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("create table if not exists schema_migrations").WillReturnResult(sqlmock.NewResult(0, 0))
+	rows := sqlmock.NewRows([]string{"version", "name", "applied_at"})
+	for v := int64(1); v <= 4; v++ {
+		rows.AddRow(v, "m", time.Now())
+	}
+	mock.ExpectQuery(`SELECT \* FROM "schema_migrations"`).WillReturnRows(rows)
+	mock.ExpectExec(regexp.QuoteMeta("select pg_advisory_unlock")).WillReturnResult(sqlmock.NewResult(0, 0))
+
+	_, err = m.Up(context.Background())
+	require.ErrorIs(t, err, storage.ErrSchemaAhead)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestPostgresMigrateDownUp(t *testing.T) {
+	testMigrateDownUp(t, newPostgresStorage(t))
+}
+
+func TestSQLiteMigrateDownUp(t *testing.T) {
+	testMigrateDownUp(t, newSQLiteStorage(t))
+}
+
+func testMigrateDownUp(t *testing.T, store *storage.Storage) {
+	ctx := context.Background()
+	m, err := store.Migrator(logrus.New())
+	require.NoError(t, err)
+
+	// повторный up после Init ничего не применяет
+	n, err := m.Up(ctx)
+	require.NoError(t, err)
+	require.Zero(t, n)
+	require.NoError(t, m.Require(ctx))
+
+	n, err = m.Down(ctx, 1)
+	require.NoError(t, err)
+	require.Equal(t, 1, n)
+
+	status, err := m.Status(ctx)
+	require.NoError(t, err)
+	require.Nil(t, status[len(status)-1].AppliedAt)
+	require.True(t, errors.Is(m.Require(ctx), storage.ErrSchemaBehind))
+
+	n, err = m.Up(ctx)
+	require.NoError(t, err)
+	require.Equal(t, 1, n)
+	require.NoError(t, m.Require(ctx))
+}
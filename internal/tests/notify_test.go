@@ -0,0 +1,116 @@
+package tests
+
+import (
+	"Tages/internal/cache"
+	"Tages/internal/dto"
+	"Tages/internal/service"
+	"Tages/internal/storage"
+	pb "Tages/pkg"
+	"Tages/pkg/mocks"
+	"context"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDecodeFileEvent(t *testing.T) {
+	id := uuid.New()
+	ev, err := storage.DecodeFileEvent(`{"op":"upsert","id":"` + id.String() + `","name":"a.png"}`)
+	require.NoError(t, err)
+	require.Equal(t, storage.FileEvent{Op: storage.FileEventUpsert, ID: id, Name: "a.png"}, ev)
+
+	_, err = storage.DecodeFileEvent(`{"op":"rename","name":"a.png"}`)
+	require.Error(t, err)
+	_, err = storage.DecodeFileEvent(`{"op":"upsert"}`)
+	require.Error(t, err)
+	_, err = storage.DecodeFileEvent(`not json`)
+	require.Error(t, err)
+}
+
+func TestApplyFileEventFromOtherReplica(t *testing.T) {
+	viper.Set("upload.dir", t.TempDir())
+	logger := logrus.New()
+
+	files := map[string]dto.File{
+		"a.png": {ID: uuid.New(), Name: "a.png"},
+	}
+	mockStorage := &mocks.MockStorage{
+		GetAllFilesFn: func(ctx context.Context) ([]dto.File, error) {
+			var all []dto.File
+			for _, f := range files {
+				all = append(all, f)
+			}
+			return all, nil
+		},
+		GetFileByNameFn: func(ctx context.Context, name string) (dto.File, error) {
+			f, ok := files[name]
+			if !ok {
+				return dto.File{}, storage.ErrNotFound
+			}
+			return f, nil
+		},
+	}
+
+	c := cache.NewCache(logger, make(chan float64, 1))
+	srv, err := service.NewServicefile(context.Background(), logger, c, mockStorage)
+	require.NoError(t, err)
+	require.NoError(t, srv.HeatCache(context.Background()))
+
+	// файл загрузили через другую реплику
+	b := dto.File{ID: uuid.New(), Name: "b.png"}
+	files[b.Name] = b
+	srv.ApplyFileEvent(context.Background(), storage.FileEvent{Op: storage.FileEventUpsert, ID: b.ID, Name: b.Name})
+
+	resp, err := srv.ListFiles(context.Background(), &pb.ListRequest{})
+	require.NoError(t, err)
+	require.Len(t, resp.Files, 2)
+
+	delete(files, b.Name)
+	srv.ApplyFileEvent(context.Background(), storage.FileEvent{Op: storage.FileEventDelete, ID: b.ID, Name: b.Name})
+
+	resp, err = srv.ListFiles(context.Background(), &pb.ListRequest{})
+	require.NoError(t, err)
+	require.Len(t, resp.Files, 1)
+	require.Equal(t, "a.png", resp.Files[0].Name)
+}
+
+func TestResyncDropsFilesDeletedWhileDisconnected(t *testing.T) {
+	viper.Set("upload.dir", t.TempDir())
+	logger := logrus.New()
+
+	files := map[string]dto.File{
+		"a.png": {ID: uuid.New(), Name: "a.png"},
+		"b.png": {ID: uuid.New(), Name: "b.png"},
+	}
+	mockStorage := &mocks.MockStorage{
+		GetAllFilesFn: func(ctx context.Context) ([]dto.File, error) {
+			var all []dto.File
+			for _, f := range files {
+				all = append(all, f)
+			}
+			return all, nil
+		},
+	}
+
+	c := cache.NewCache(logger, make(chan float64, 1))
+	srv, err := service.NewServicefile(context.Background(), logger, c, mockStorage)
+	require.NoError(t, err)
+	require.NoError(t, srv.HeatCache(context.Background()))
+
+	// пока слушатель был отключен, b.png удалили, а c.png добавили на другой реплике
+	delete(files, "b.png")
+	files["c.png"] = dto.File{ID: uuid.New(), Name: "c.png"}
+
+	require.NoError(t, srv.Resync(context.Background()))
+
+	resp, err := srv.ListFiles(context.Background(), &pb.ListRequest{})
+	require.NoError(t, err)
+	var names []string
+	for _, f := range resp.Files {
+		names = append(names, f.Name)
+	}
+	require.ElementsMatch(t, []string{"a.png", "c.png"}, names)
+}
@@ -0,0 +1,127 @@
+package tests
+
+import (
+	"Tages/internal/overload"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	listMethod     = "/tages.service.FileService/ListFiles"
+	downloadMethod = "/tages.service.FileService/DownloadFileUnary"
+	uploadMethod   = "/tages.service.FileService/UploadFileUnary"
+)
+
+func newOverloadController(t *testing.T) *overload.Controller {
+	v := viper.New()
+	v.Set("overload.memory_high_percent", 80)
+	v.Set("overload.memory_critical_percent", 90)
+	v.Set("overload.target_latency_ms", 10)
+	v.Set("overload.min_limit", 2)
+	v.Set("overload.max_limit", 100)
+	v.Set("overload.priorities", []map[string]string{
+		{"method": listMethod, "priority": "low"},
+		{"method": uploadMethod, "priority": "high"},
+	})
+
+	cfg, err := overload.LoadConfig(v)
+	require.NoError(t, err)
+	return overload.New(cfg, logrus.New())
+}
+
+func callWithDelay(c *overload.Controller, method string, delay time.Duration) error {
+	info := &grpc.UnaryServerInfo{FullMethod: method}
+	_, err := c.UnaryInterceptor()(context.Background(), nil, info, func(ctx context.Context, req interface{}) (interface{}, error) {
+		time.Sleep(delay)
+		return nil, nil
+	})
+	return err
+}
+
+func TestOverloadShedsLowPriorityFirst(t *testing.T) {
+	c := newOverloadController(t)
+
+	c.Observe(overload.Sample{MemoryPercent: 85})
+	require.Equal(t, overload.LevelElevated, c.Level())
+	require.Equal(t, codes.ResourceExhausted, status.Code(callWithDelay(c, listMethod, 0)))
+	require.NoError(t, callWithDelay(c, downloadMethod, 0))
+
+	c.Observe(overload.Sample{MemoryPercent: 95})
+	require.Equal(t, codes.ResourceExhausted, status.Code(callWithDelay(c, downloadMethod, 0)))
+	require.NoError(t, callWithDelay(c, uploadMethod, 0))
+
+	// давление ушло - вызовы снова проходят
+	c.Observe(overload.Sample{MemoryPercent: 40})
+	require.Equal(t, overload.LevelNone, c.Level())
+	require.NoError(t, callWithDelay(c, listMethod, 0))
+}
+
+func TestOverloadLimitFollowsLatency(t *testing.T) {
+	c := newOverloadController(t)
+	require.Equal(t, 100, c.Limit())
+
+	// медленные ответы мультипликативно снижают лимит
+	require.NoError(t, callWithDelay(c, downloadMethod, 30*time.Millisecond))
+	for i := 0; i < 5; i++ {
+		c.Observe(overload.Sample{})
+	}
+	reduced := c.Limit()
+	require.Less(t, reduced, 100)
+
+	// после восстановления задержки лимит растет аддитивно
+	for i := 0; i < 30; i++ {
+		require.NoError(t, callWithDelay(c, downloadMethod, 0))
+	}
+	c.Observe(overload.Sample{})
+	c.Observe(overload.Sample{})
+	require.Equal(t, reduced+2, c.Limit())
+}
+
+type delayedStream struct {
+	grpc.ServerStream
+	recvDelay time.Duration
+}
+
+func (s *delayedStream) Context() context.Context { return context.Background() }
+
+func (s *delayedStream) RecvMsg(m interface{}) error {
+	time.Sleep(s.recvDelay)
+	return nil
+}
+
+func (s *delayedStream) SendMsg(m interface{}) error { return nil }
+
+func streamWithDelay(c *overload.Controller, recvDelay, work time.Duration) error {
+	info := &grpc.StreamServerInfo{FullMethod: "/tages.service.FileService/DownloadFileStream"}
+	return c.StreamInterceptor()(nil, &delayedStream{recvDelay: recvDelay}, info, func(srv interface{}, ss grpc.ServerStream) error {
+		if err := ss.RecvMsg(nil); err != nil {
+			return err
+		}
+		time.Sleep(work)
+		return ss.SendMsg(nil)
+	})
+}
+
+func TestOverloadLatencyIncludesStreams(t *testing.T) {
+	// медленный клиент не считается задержкой сервера
+	c := newOverloadController(t)
+	require.NoError(t, streamWithDelay(c, 30*time.Millisecond, 0))
+	c.Observe(overload.Sample{})
+	require.Equal(t, 100, c.Limit())
+
+	// медленный первый чанк снижает лимит
+	c = newOverloadController(t)
+	require.NoError(t, streamWithDelay(c, 0, 30*time.Millisecond))
+	for i := 0; i < 5; i++ {
+		c.Observe(overload.Sample{})
+	}
+	require.Less(t, c.Limit(), 100)
+}
@@ -0,0 +1,81 @@
+package tests
+
+import (
+	"Tages/internal/ratelimiter"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func newRedisLimiter(t *testing.T, addr string, tokens int) *ratelimiter.RateLimiter {
+	backend := ratelimiter.NewRedisBackend(ratelimiter.RedisConfig{
+		Addr:      addr,
+		KeyPrefix: "test:rl:",
+		Timeout:   200 * time.Millisecond,
+	})
+	rl := ratelimiter.New(ratelimiter.Policies{
+		Default: ratelimiter.Policy{MaxTokens: tokens, RefillEvery: time.Hour, Cost: 1},
+	}, backend, nil, logrus.New())
+	t.Cleanup(rl.Stop)
+	return rl
+}
+
+func TestRedisBackendSharesLimitAcrossReplicas(t *testing.T) {
+	mr := miniredis.RunT(t)
+
+	replicaA := newRedisLimiter(t, mr.Addr(), 4)
+	replicaB := newRedisLimiter(t, mr.Addr(), 4)
+
+	// лимит 4 на клиента, запросы размазаны по двум репликам
+	require.NoError(t, callUnary(replicaA, peerCtx("192.0.2.50", 1)))
+	require.NoError(t, callUnary(replicaB, peerCtx("192.0.2.50", 2)))
+	require.NoError(t, callUnary(replicaA, peerCtx("192.0.2.50", 3)))
+	require.NoError(t, callUnary(replicaB, peerCtx("192.0.2.50", 4)))
+
+	require.Equal(t, codes.ResourceExhausted, status.Code(callUnary(replicaA, peerCtx("192.0.2.50", 5))))
+	require.Equal(t, codes.ResourceExhausted, status.Code(callUnary(replicaB, peerCtx("192.0.2.50", 6))))
+
+	require.Len(t, mr.Keys(), 1)
+}
+
+func TestRedisBackendFallsBackToLocalBuckets(t *testing.T) {
+	mr := miniredis.RunT(t)
+	rl := newRedisLimiter(t, mr.Addr(), 2)
+
+	require.NoError(t, callUnary(rl, peerCtx("192.0.2.60", 1)))
+	mr.Close()
+
+	// backend недоступен - лимит продолжает работать на локальном бакете
+	require.NoError(t, callUnary(rl, peerCtx("192.0.2.60", 2)))
+	require.NoError(t, callUnary(rl, peerCtx("192.0.2.60", 3)))
+	require.Equal(t, codes.ResourceExhausted, status.Code(callUnary(rl, peerCtx("192.0.2.60", 4))))
+}
+
+func TestRedisBackendUsesServerClock(t *testing.T) {
+	mr := miniredis.RunT(t)
+	backend := ratelimiter.NewRedisBackend(ratelimiter.RedisConfig{Addr: mr.Addr(), Timeout: 200 * time.Millisecond})
+	defer backend.Close()
+
+	policy := ratelimiter.Policy{MaxTokens: 1, RefillEvery: time.Minute, Cost: 1}
+	now := time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)
+	mr.SetTime(now)
+
+	res, err := backend.Take(context.Background(), "k", policy)
+	require.NoError(t, err)
+	require.True(t, res.Allowed)
+	res, err = backend.Take(context.Background(), "k", policy)
+	require.NoError(t, err)
+	require.False(t, res.Allowed)
+
+	// пополнение считается по часам redis, локальные часы не сдвигались
+	mr.SetTime(now.Add(time.Minute))
+	res, err = backend.Take(context.Background(), "k", policy)
+	require.NoError(t, err)
+	require.True(t, res.Allowed)
+}
@@ -0,0 +1,417 @@
+package tests
+
+import (
+	"Tages/internal/clientinfo"
+	"Tages/internal/metrics"
+	"Tages/internal/ratelimiter"
+	pb "Tages/pkg"
+	"context"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+func peerCtx(ip string, port int) context.Context {
+	return peer.NewContext(context.Background(), &peer.Peer{
+		Addr: &net.TCPAddr{IP: net.ParseIP(ip), Port: port},
+	})
+}
+
+func callUnary(rl *ratelimiter.RateLimiter, ctx context.Context) error {
+	info := &grpc.UnaryServerInfo{FullMethod: "/tages.service.FileService/ListFiles"}
+	_, err := rl.UnaryInterceptor()(ctx, nil, info, func(ctx context.Context, req interface{}) (interface{}, error) {
+		return nil, nil
+	})
+	return err
+}
+
+func TestRateLimiterReconnectDoesNotResetBucket(t *testing.T) {
+	rl := ratelimiter.New(ratelimiter.Policies{
+		Default: ratelimiter.Policy{MaxTokens: 3, RefillEvery: time.Hour, Cost: 1},
+	}, nil, nil, logrus.New())
+	defer rl.Stop()
+
+	// каждый вызов - новое TCP-соединение с новым эфемерным портом
+	for port := 50000; port < 50003; port++ {
+		require.NoError(t, callUnary(rl, peerCtx("192.0.2.10", port)))
+	}
+
+	err := callUnary(rl, peerCtx("192.0.2.10", 50003))
+	require.Equal(t, codes.ResourceExhausted, status.Code(err))
+
+	// другой клиент со своим бакетом
+	require.NoError(t, callUnary(rl, peerCtx("192.0.2.11", 50000)))
+}
+
+func TestRateLimiterStreamReconnectDoesNotResetBucket(t *testing.T) {
+	rl := ratelimiter.New(ratelimiter.Policies{
+		Default: ratelimiter.Policy{MaxTokens: 1, RefillEvery: time.Hour, Cost: 1},
+	}, nil, nil, logrus.New())
+	defer rl.Stop()
+
+	info := &grpc.StreamServerInfo{FullMethod: "/tages.service.FileService/DownloadFileStream"}
+	call := func(port int) error {
+		ss := &ctxServerStream{ctx: peerCtx("192.0.2.20", port)}
+		return rl.StreamInterceptor()(nil, ss, info, func(srv interface{}, stream grpc.ServerStream) error {
+			return nil
+		})
+	}
+
+	require.NoError(t, call(40000))
+	require.Equal(t, codes.ResourceExhausted, status.Code(call(40001)))
+}
+
+func TestRateLimiterSetPoliciesKeepsBuckets(t *testing.T) {
+	policies := func(tokens int) ratelimiter.Policies {
+		return ratelimiter.Policies{
+			Default: ratelimiter.Policy{MaxTokens: tokens, RefillEvery: time.Hour, Cost: 1},
+		}
+	}
+	rl := ratelimiter.New(policies(2), nil, nil, logrus.New())
+	defer rl.Stop()
+
+	ctx := peerCtx("192.0.2.40", 1)
+	require.NoError(t, callUnary(rl, ctx))
+	require.NoError(t, callUnary(rl, ctx))
+	require.Equal(t, codes.ResourceExhausted, status.Code(callUnary(rl, ctx)))
+
+	// перезагрузка с теми же лимитами не пополняет бакет
+	rl.SetPolicies(policies(2))
+	require.Equal(t, codes.ResourceExhausted, status.Code(callUnary(rl, ctx)))
+
+	// больший бакет не возвращает уже потраченные токены
+	rl.SetPolicies(policies(5))
+	require.Equal(t, codes.ResourceExhausted, status.Code(callUnary(rl, ctx)))
+	require.Equal(t, 1, rl.Stats().Buckets)
+}
+
+func TestTokenBucketReconfigure(t *testing.T) {
+	tb := ratelimiter.NewTokenBucket(10, time.Hour)
+	require.True(t, tb.AllowN(4))
+
+	// при уменьшении остаток обрезается до нового размера
+	tb.Reconfigure(3, time.Hour)
+	require.True(t, tb.AllowN(3))
+	require.False(t, tb.Allow())
+
+	// новая скорость пополнения действует сразу
+	tb.Reconfigure(3, time.Millisecond)
+	require.Eventually(t, func() bool { return tb.AllowN(3) }, time.Second, 5*time.Millisecond)
+}
+
+func TestIPv6PrefixKey(t *testing.T) {
+	key := clientinfo.IPv6PrefixKey(64)
+
+	a := key(peerCtx("2001:db8:1:2::1", 1000))
+	b := key(peerCtx("2001:db8:1:2:ffff::9", 2000))
+	c := key(peerCtx("2001:db8:1:3::1", 1000))
+
+	require.Equal(t, a, b)
+	require.NotEqual(t, a, c)
+	require.Equal(t, "192.0.2.1", key(peerCtx("192.0.2.1", 1000)))
+}
+
+func TestForwardedForKey(t *testing.T) {
+	trusted, err := clientinfo.ParseCIDRs([]string{"10.0.0.0/8"})
+	require.NoError(t, err)
+	key := clientinfo.ForwardedForKey(trusted)
+
+	md := metadata.Pairs("x-forwarded-for", "198.51.100.7, 10.1.1.1")
+
+	// от доверенного прокси берем первый недоверенный адрес справа
+	ctx := metadata.NewIncomingContext(peerCtx("10.0.0.5", 1234), md)
+	require.Equal(t, "198.51.100.7", key(ctx))
+
+	// заголовок от недоверенного клиента игнорируется
+	ctx = metadata.NewIncomingContext(peerCtx("203.0.113.9", 1234), md)
+	require.Equal(t, "203.0.113.9", key(ctx))
+}
+
+func TestIdentityAndAPIKey(t *testing.T) {
+	trusted, err := clientinfo.ParseCIDRs([]string{"10.0.0.0/8"})
+	require.NoError(t, err)
+	md := metadata.Pairs(
+		"x-client-id", "alice",
+		"x-api-key", "secret",
+	)
+
+	// x-client-id принимаем только от доверенного прокси
+	identity := clientinfo.IdentityKey(trusted, clientinfo.HostKey)
+	require.Equal(t, "id:alice", identity(metadata.NewIncomingContext(peerCtx("10.0.0.5", 1), md)))
+	require.Equal(t, "192.0.2.1", identity(metadata.NewIncomingContext(peerCtx("192.0.2.1", 1), md)))
+
+	apiKeyKey := clientinfo.APIKeyKey([]string{"secret"}, clientinfo.HostKey)
+	apiKey := apiKeyKey(metadata.NewIncomingContext(peerCtx("192.0.2.1", 1), md))
+	require.NotContains(t, apiKey, "secret")
+	require.Equal(t, apiKey, apiKeyKey(
+		metadata.NewIncomingContext(peerCtx("192.0.2.99", 2), metadata.Pairs("x-api-key", "secret")),
+	))
+
+	// без ключа и с незнакомым ключом - лимит по адресу
+	require.Equal(t, "192.0.2.1", apiKeyKey(peerCtx("192.0.2.1", 1)))
+	require.Equal(t, "192.0.2.1", apiKeyKey(
+		metadata.NewIncomingContext(peerCtx("192.0.2.1", 1), metadata.Pairs("x-api-key", "guess")),
+	))
+
+	_, err = clientinfo.NewKeyFunc("api_key", clientinfo.KeyOptions{})
+	require.Error(t, err)
+}
+
+func TestRateLimiterRotatingHeadersDoNotResetBucket(t *testing.T) {
+	for _, kind := range []string{"identity", "api_key"} {
+		t.Run(kind, func(t *testing.T) {
+			key, err := clientinfo.NewKeyFunc(kind, clientinfo.KeyOptions{APIKeys: []string{"issued"}})
+			require.NoError(t, err)
+			rl := ratelimiter.New(ratelimiter.Policies{
+				Default: ratelimiter.Policy{MaxTokens: 2, RefillEvery: time.Hour, Cost: 1},
+			}, nil, key, logrus.New())
+			defer rl.Stop()
+
+			call := func(i int) error {
+				v := fmt.Sprintf("rotated-%d", i)
+				return callUnary(rl, metadata.NewIncomingContext(peerCtx("192.0.2.30", 1000+i),
+					metadata.Pairs("x-client-id", v, "x-api-key", v)))
+			}
+
+			require.NoError(t, call(0))
+			require.NoError(t, call(1))
+			require.Equal(t, codes.ResourceExhausted, status.Code(call(2)))
+		})
+	}
+}
+
+type ctxServerStream struct {
+	grpc.ServerStream
+	ctx    context.Context
+	header metadata.MD
+}
+
+func (s *ctxServerStream) Context() context.Context {
+	return s.ctx
+}
+
+func (s *ctxServerStream) SetHeader(md metadata.MD) error {
+	s.header = metadata.Join(s.header, md)
+	return nil
+}
+
+func TestRateLimiterPerMethodPolicies(t *testing.T) {
+	v := viper.New()
+	v.Set("ratelimiter.tokens", 2)
+	v.Set("ratelimiter.interval_ms", 1000)
+	v.Set("ratelimiter.policies", []map[string]interface{}{
+		{"method": "/tages.service.FileService/ListFiles", "tokens": 5},
+		{"method": "/tages.service.FileService/UploadFileUnary", "tokens": 10, "cost": 5},
+	})
+
+	policies, err := ratelimiter.LoadPolicies(v)
+	require.NoError(t, err)
+
+	list, _ := policies.For("/tages.service.FileService/ListFiles")
+	require.Equal(t, ratelimiter.Policy{MaxTokens: 5, RefillEvery: time.Second, Cost: 1}, list)
+
+	rl := ratelimiter.New(policies, nil, nil, logrus.New())
+	defer rl.Stop()
+
+	call := func(method string) error {
+		info := &grpc.UnaryServerInfo{FullMethod: method}
+		_, err := rl.UnaryInterceptor()(peerCtx("192.0.2.30", 1), nil, info, func(ctx context.Context, req interface{}) (interface{}, error) {
+			return nil, nil
+		})
+		return err
+	}
+
+	// загрузка стоит 5 токенов из 10
+	require.NoError(t, call("/tages.service.FileService/UploadFileUnary"))
+	require.NoError(t, call("/tages.service.FileService/UploadFileUnary"))
+	require.Equal(t, codes.ResourceExhausted, status.Code(call("/tages.service.FileService/UploadFileUnary")))
+
+	// у ListFiles свой бакет
+	for i := 0; i < 5; i++ {
+		require.NoError(t, call("/tages.service.FileService/ListFiles"))
+	}
+	require.Equal(t, codes.ResourceExhausted, status.Code(call("/tages.service.FileService/ListFiles")))
+
+	// остальные методы делят бакет по умолчанию
+	require.NoError(t, call("/tages.service.FileService/DownloadFileUnary"))
+	require.NoError(t, call("/tages.service.FileService/UploadFileStream"))
+	require.Equal(t, codes.ResourceExhausted, status.Code(call("/tages.service.FileService/DownloadFileUnary")))
+}
+
+func TestLoadPoliciesRejectsInvalid(t *testing.T) {
+	v := viper.New()
+	v.Set("ratelimiter.tokens", 2)
+	v.Set("ratelimiter.interval_ms", 1000)
+	v.Set("ratelimiter.policies", []map[string]interface{}{
+		{"method": "/tages.service.FileService/UploadFileUnary", "cost": 5},
+	})
+
+	_, err := ratelimiter.LoadPolicies(v)
+	require.Error(t, err)
+}
+
+type sinkServerStream struct {
+	ctxServerStream
+	sent int
+}
+
+func (s *sinkServerStream) SendMsg(m interface{}) error {
+	s.sent++
+	return nil
+}
+
+func TestBandwidthPacesStreamSends(t *testing.T) {
+	bw := ratelimiter.NewBandwidth(ratelimiter.BandwidthConfig{
+		ClientBytesPerSec: 100 * 1024,
+		ClientBurst:       10 * 1024,
+	}, nil, logrus.New())
+	defer bw.Stop()
+
+	chunk := &pb.DownloadResponse{Data: make([]byte, 10*1024)}
+	info := &grpc.StreamServerInfo{FullMethod: "/tages.service.FileService/DownloadFileStream"}
+	ss := &sinkServerStream{ctxServerStream: ctxServerStream{ctx: peerCtx("192.0.2.40", 1)}}
+
+	start := time.Now()
+	err := bw.StreamInterceptor()(nil, ss, info, func(srv interface{}, stream grpc.ServerStream) error {
+		for i := 0; i < 4; i++ {
+			if err := stream.SendMsg(chunk); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	require.NoError(t, err)
+	require.Equal(t, 4, ss.sent)
+
+	// первый чанк укладывается в burst, остальные 30 КБ идут на 100 КБ/с
+	require.GreaterOrEqual(t, time.Since(start), 250*time.Millisecond)
+}
+
+func TestBandwidthStopsWaitingOnCancel(t *testing.T) {
+	bw := ratelimiter.NewBandwidth(ratelimiter.BandwidthConfig{
+		GlobalBytesPerSec: 1024,
+	}, nil, logrus.New())
+	defer bw.Stop()
+
+	ctx, cancel := context.WithTimeout(peerCtx("192.0.2.41", 1), 50*time.Millisecond)
+	defer cancel()
+
+	chunk := &pb.DownloadResponse{Data: make([]byte, 64*1024)}
+	info := &grpc.StreamServerInfo{FullMethod: "/tages.service.FileService/DownloadFileStream"}
+	ss := &sinkServerStream{ctxServerStream: ctxServerStream{ctx: ctx}}
+
+	throttled := testutil.ToFloat64(metrics.BandwidthThrottledSeconds.WithLabelValues(info.FullMethod, "send"))
+	err := bw.StreamInterceptor()(nil, ss, info, func(srv interface{}, stream grpc.ServerStream) error {
+		if err := stream.SendMsg(chunk); err != nil {
+			return err
+		}
+		return stream.SendMsg(chunk)
+	})
+	require.Equal(t, codes.DeadlineExceeded, status.Code(err))
+
+	// в метрику идет фактическое ожидание, а не запланированная минута
+	waited := testutil.ToFloat64(metrics.BandwidthThrottledSeconds.WithLabelValues(info.FullMethod, "send")) - throttled
+	require.Less(t, waited, 1.0)
+}
+
+func TestBandwidthRefundsCancelledReservation(t *testing.T) {
+	bw := ratelimiter.NewBandwidth(ratelimiter.BandwidthConfig{
+		ClientBytesPerSec: 100 * 1024,
+		ClientBurst:       10 * 1024,
+		GlobalBytesPerSec: 100 * 1024,
+		GlobalBurst:       10 * 1024,
+	}, nil, logrus.New())
+	defer bw.Stop()
+
+	info := &grpc.StreamServerInfo{FullMethod: "/tages.service.FileService/DownloadFileStream"}
+	send := func(ctx context.Context, size int) error {
+		ss := &sinkServerStream{ctxServerStream: ctxServerStream{ctx: ctx}}
+		return bw.StreamInterceptor()(nil, ss, info, func(srv interface{}, stream grpc.ServerStream) error {
+			return stream.SendMsg(&pb.DownloadResponse{Data: make([]byte, size)})
+		})
+	}
+
+	// чанк в 200 КБ ждал бы ~2 с, стрим отменяется раньше
+	ctx, cancel := context.WithTimeout(peerCtx("192.0.2.42", 1), 20*time.Millisecond)
+	defer cancel()
+	require.Equal(t, codes.DeadlineExceeded, status.Code(send(ctx, 200*1024)))
+
+	// непереданные байты вернулись, следующий стрим клиента не ждет чужой долг
+	start := time.Now()
+	require.NoError(t, send(peerCtx("192.0.2.42", 2), 8*1024))
+	require.Less(t, time.Since(start), 500*time.Millisecond)
+}
+
+// headerCapture подставляется вместо транспорта, чтобы поймать grpc.SetHeader
+type headerCapture struct {
+	grpc.ServerTransportStream
+	header metadata.MD
+}
+
+func (h *headerCapture) SetHeader(md metadata.MD) error {
+	h.header = metadata.Join(h.header, md)
+	return nil
+}
+
+func TestRateLimiterQuotaFeedback(t *testing.T) {
+	rl := ratelimiter.New(ratelimiter.Policies{
+		Default: ratelimiter.Policy{MaxTokens: 2, RefillEvery: 10 * time.Second, Cost: 1},
+	}, nil, nil, logrus.New())
+	defer rl.Stop()
+
+	call := func() (metadata.MD, error) {
+		capture := &headerCapture{}
+		ctx := grpc.NewContextWithServerTransportStream(peerCtx("192.0.2.70", 1), capture)
+		return capture.header, callUnary(rl, ctx)
+	}
+
+	md, err := call()
+	require.NoError(t, err)
+	require.Equal(t, []string{"2"}, md.Get(ratelimiter.HeaderLimit))
+	require.Equal(t, []string{"1"}, md.Get(ratelimiter.HeaderRemaining))
+	require.Equal(t, []string{"10"}, md.Get(ratelimiter.HeaderReset))
+	require.Empty(t, md.Get(ratelimiter.HeaderRetryAfter))
+
+	_, err = call()
+	require.NoError(t, err)
+
+	md, err = call()
+	require.Equal(t, []string{"0"}, md.Get(ratelimiter.HeaderRemaining))
+	require.Equal(t, []string{"10"}, md.Get(ratelimiter.HeaderRetryAfter))
+
+	st := status.Convert(err)
+	require.Equal(t, codes.ResourceExhausted, st.Code())
+	require.Len(t, st.Details(), 1)
+	retry, ok := st.Details()[0].(*errdetails.RetryInfo)
+	require.True(t, ok)
+	require.InDelta(t, 10*time.Second, retry.RetryDelay.AsDuration(), float64(time.Second))
+}
+
+func TestRateLimiterStreamQuotaHeaders(t *testing.T) {
+	rl := ratelimiter.New(ratelimiter.Policies{
+		Default: ratelimiter.Policy{MaxTokens: 5, RefillEvery: time.Second, Cost: 2},
+	}, nil, nil, logrus.New())
+	defer rl.Stop()
+
+	ss := &ctxServerStream{ctx: peerCtx("192.0.2.71", 1)}
+	info := &grpc.StreamServerInfo{FullMethod: "/tages.service.FileService/UploadFileStream"}
+	err := rl.StreamInterceptor()(nil, ss, info, func(srv interface{}, stream grpc.ServerStream) error {
+		return nil
+	})
+	require.NoError(t, err)
+	require.Equal(t, []string{"5"}, ss.header.Get(ratelimiter.HeaderLimit))
+	require.Equal(t, []string{"3"}, ss.header.Get(ratelimiter.HeaderRemaining))
+	require.Equal(t, []string{"2"}, ss.header.Get(ratelimiter.HeaderReset))
+}
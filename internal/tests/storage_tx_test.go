@@ -0,0 +1,230 @@
+package tests
+
+import (
+	"Tages/internal/dto"
+	"Tages/internal/storage"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+)
+
+func newMockStorage(t *testing.T) (*storage.Storage, sqlmock.Sqlmock) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+
+	store, err := storage.NewStorageWithDB(db)
+	require.NoError(t, err)
+	store.SetTxRetry(3, time.Millisecond)
+	return store, mock
+}
+
+func expectInsertFile(mock sqlmock.Sqlmock) *sqlmock.ExpectedQuery {
+	return mock.ExpectQuery(`INSERT INTO "files"`)
+}
+
+func TestTxCommitErrorIsReturned(t *testing.T) {
+	store, mock := newMockStorage(t)
+
+	mock.ExpectBegin()
+	expectInsertFile(mock).WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(uuid.New()))
+	mock.ExpectCommit().WillReturnError(errors.New("connection reset"))
+
+	err := store.WithInTransaction(context.Background(), func(ctx context.Context) error {
+		return store.AddFile(ctx, dto.File{Name: "a.txt"})
+	})
+	require.ErrorContains(t, err, "connection reset")
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestTxRollbackOnError(t *testing.T) {
+	store, mock := newMockStorage(t)
+
+	mock.ExpectBegin()
+	expectInsertFile(mock).WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(uuid.New()))
+	mock.ExpectRollback()
+
+	boom := errors.New("boom")
+	err := store.WithInTransaction(context.Background(), func(ctx context.Context) error {
+		require.NoError(t, store.AddFile(ctx, dto.File{Name: "a.txt"}))
+		return boom
+	})
+	require.ErrorIs(t, err, boom)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestTxRetriesSerializationFailure(t *testing.T) {
+	store, mock := newMockStorage(t)
+
+	mock.ExpectBegin()
+	expectInsertFile(mock).WillReturnError(&pgconn.PgError{Code: "40001", Message: "could not serialize access"})
+	mock.ExpectRollback()
+	mock.ExpectBegin()
+	expectInsertFile(mock).WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(uuid.New()))
+	mock.ExpectCommit()
+
+	calls := 0
+	err := store.WithInTransaction(context.Background(), func(ctx context.Context) error {
+		calls++
+		return store.AddFile(ctx, dto.File{Name: "a.txt"})
+	})
+	require.NoError(t, err)
+	require.Equal(t, 2, calls)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestTxDoesNotRetryOtherErrors(t *testing.T) {
+	store, mock := newMockStorage(t)
+
+	mock.ExpectBegin()
+	expectInsertFile(mock).WillReturnError(&pgconn.PgError{Code: "23505", Message: "duplicate key"})
+	mock.ExpectRollback()
+
+	calls := 0
+	err := store.WithInTransaction(context.Background(), func(ctx context.Context) error {
+		calls++
+		return store.AddFile(ctx, dto.File{Name: "a.txt"})
+	})
+	require.Error(t, err)
+	require.Equal(t, 1, calls)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestTxNestedSavepoint(t *testing.T) {
+	store, mock := newMockStorage(t)
+
+	mock.ExpectBegin()
+	mock.ExpectExec(`SAVEPOINT sp_1`).WillReturnResult(sqlmock.NewResult(0, 0))
+	expectInsertFile(mock).WillReturnError(errors.New("inner failed"))
+	mock.ExpectExec(`ROLLBACK TO SAVEPOINT sp_1`).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(`SAVEPOINT sp_1`).WillReturnResult(sqlmock.NewResult(0, 0))
+	expectInsertFile(mock).WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(uuid.New()))
+	mock.ExpectExec(`RELEASE SAVEPOINT sp_1`).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectCommit()
+
+	err := store.WithInTransaction(context.Background(), func(ctx context.Context) error {
+		// ошибка вложенной части откатывает только ее
+		innerErr := store.WithInTransaction(ctx, func(ctx context.Context) error {
+			return store.AddFile(ctx, dto.File{Name: "bad.txt"})
+		})
+		require.Error(t, innerErr)
+
+		return store.WithInTransaction(ctx, func(ctx context.Context) error {
+			return store.AddFile(ctx, dto.File{Name: "good.txt"})
+		})
+	})
+	require.NoError(t, err)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+// newPostgresStorage - хранилище на реальном Postgres из TAGES_TEST_DSN
+func newPostgresStorage(t *testing.T) *storage.Storage {
+	dsn := os.Getenv("TAGES_TEST_DSN")
+	if dsn == "" {
+		t.Skip("TAGES_TEST_DSN is not set")
+	}
+
+	store, err := storage.NewStorage(dsn)
+	require.NoError(t, err)
+	require.NoError(t, store.Init(context.Background(), logrus.New()))
+	t.Cleanup(func() { store.Close(context.Background()) })
+	return store
+}
+
+// newSQLiteStorage - хранилище на SQLite во временном каталоге
+func newSQLiteStorage(t *testing.T) *storage.Storage {
+	store, err := storage.NewStorage("sqlite://" + filepath.Join(t.TempDir(), "tages.db"))
+	require.NoError(t, err)
+	require.NoError(t, store.Init(context.Background(), logrus.New()))
+	t.Cleanup(func() { store.Close(context.Background()) })
+	return store
+}
+
+func TestPostgresTxRollback(t *testing.T) {
+	testTxRollback(t, newPostgresStorage(t))
+}
+
+func TestSQLiteTxRollback(t *testing.T) {
+	testTxRollback(t, newSQLiteStorage(t))
+}
+
+func testTxRollback(t *testing.T, store *storage.Storage) {
+	ctx := context.Background()
+	name := "tx-rollback-" + uuid.NewString()
+
+	boom := errors.New("boom")
+	err := store.WithInTransaction(ctx, func(txCtx context.Context) error {
+		require.NoError(t, store.AddFile(txCtx, dto.File{Name: name}))
+
+		// внутри транзакции запись видна, снаружи - нет
+		_, err := store.GetFileByName(txCtx, name)
+		require.NoError(t, err)
+		_, err = store.GetFileByName(ctx, name)
+		require.ErrorIs(t, err, storage.ErrNotFound)
+		return boom
+	})
+	require.ErrorIs(t, err, boom)
+
+	_, err = store.GetFileByName(ctx, name)
+	require.ErrorIs(t, err, storage.ErrNotFound)
+}
+
+func TestPostgresTxCommit(t *testing.T) {
+	testTxCommit(t, newPostgresStorage(t))
+}
+
+func TestSQLiteTxCommit(t *testing.T) {
+	testTxCommit(t, newSQLiteStorage(t))
+}
+
+func testTxCommit(t *testing.T, store *storage.Storage) {
+	ctx := context.Background()
+	name := "tx-commit-" + uuid.NewString()
+
+	require.NoError(t, store.WithInTransaction(ctx, func(txCtx context.Context) error {
+		return store.AddFile(txCtx, dto.File{Name: name})
+	}))
+
+	f, err := store.GetFileByName(ctx, name)
+	require.NoError(t, err)
+	require.Equal(t, name, f.Name)
+}
+
+func TestPostgresTxNestedRollback(t *testing.T) {
+	testTxNestedRollback(t, newPostgresStorage(t))
+}
+
+func TestSQLiteTxNestedRollback(t *testing.T) {
+	testTxNestedRollback(t, newSQLiteStorage(t))
+}
+
+func testTxNestedRollback(t *testing.T, store *storage.Storage) {
+	ctx := context.Background()
+	outer := "tx-outer-" + uuid.NewString()
+	inner := "tx-inner-" + uuid.NewString()
+
+	require.NoError(t, store.WithInTransaction(ctx, func(txCtx context.Context) error {
+		require.NoError(t, store.AddFile(txCtx, dto.File{Name: outer}))
+
+		err := store.WithInTransaction(txCtx, func(spCtx context.Context) error {
+			require.NoError(t, store.AddFile(spCtx, dto.File{Name: inner}))
+			return errors.New("inner failed")
+		})
+		require.Error(t, err)
+		return nil
+	}))
+
+	_, err := store.GetFileByName(ctx, outer)
+	require.NoError(t, err)
+	_, err = store.GetFileByName(ctx, inner)
+	require.ErrorIs(t, err, storage.ErrNotFound)
+}
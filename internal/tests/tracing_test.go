@@ -0,0 +1,129 @@
+package tests
+
+import (
+	"Tages/internal/cache"
+	"Tages/internal/service"
+	"Tages/internal/tracing"
+	pb "Tages/pkg"
+	"Tages/pkg/mocks"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+func setupTracing(t *testing.T) *tracetest.InMemoryExporter {
+	exporter := tracetest.NewInMemoryExporter()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+
+	prevProvider, prevPropagator := otel.GetTracerProvider(), otel.GetTextMapPropagator()
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	t.Cleanup(func() {
+		otel.SetTracerProvider(prevProvider)
+		otel.SetTextMapPropagator(prevPropagator)
+	})
+	return exporter
+}
+
+func findSpan(t *testing.T, spans tracetest.SpanStubs, name string) tracetest.SpanStub {
+	for _, s := range spans {
+		if s.Name == name {
+			return s
+		}
+	}
+	t.Fatalf("span %q not recorded", name)
+	return tracetest.SpanStub{}
+}
+
+func spanAttr(s tracetest.SpanStub, key attribute.Key) attribute.Value {
+	for _, kv := range s.Attributes {
+		if kv.Key == key {
+			return kv.Value
+		}
+	}
+	return attribute.Value{}
+}
+
+func TestTracingContinuesClientTrace(t *testing.T) {
+	exporter := setupTracing(t)
+
+	const traceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(
+		"traceparent", "00-"+traceID+"-00f067aa0ba902b7-01",
+	))
+
+	info := &grpc.UnaryServerInfo{FullMethod: "/tages.service.FileService/ListFiles"}
+	_, err := tracing.UnaryServerInterceptor()(ctx, nil, info, func(ctx context.Context, req interface{}) (interface{}, error) {
+		_, span := tracing.Start(ctx, "inner")
+		span.End()
+		return nil, nil
+	})
+	require.NoError(t, err)
+
+	spans := exporter.GetSpans()
+	server := findSpan(t, spans, info.FullMethod)
+	require.Equal(t, traceID, server.SpanContext.TraceID().String())
+	require.Equal(t, "00f067aa0ba902b7", server.Parent.SpanID().String())
+
+	inner := findSpan(t, spans, "inner")
+	require.Equal(t, server.SpanContext.SpanID(), inner.Parent.SpanID())
+}
+
+func TestTracingFileTransferSpans(t *testing.T) {
+	exporter := setupTracing(t)
+
+	dir := t.TempDir()
+	viper.Set("upload.dir", dir)
+	logger := logrus.New()
+	c := cache.NewCache(logger, make(chan float64, 1))
+	srv, err := service.NewServicefile(context.Background(), logger, c, &mocks.MockStorage{})
+	require.NoError(t, err)
+
+	content := make([]byte, 150*1024)
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "big.bin"), content, 0644))
+
+	ctx, root := tracing.Start(context.Background(), "test")
+	stream := &tracedDownloadStream{ctx: ctx}
+	require.NoError(t, srv.DownloadFileStream(&pb.DownloadRequest{Filename: "big.bin"}, stream))
+
+	_, err = srv.UploadFileUnary(ctx, &pb.UploadRequest{Filename: "a.txt", Data: []byte("hello")})
+	require.NoError(t, err)
+	root.End()
+
+	spans := exporter.GetSpans()
+
+	read := findSpan(t, spans, "file.read")
+	require.Equal(t, root.SpanContext().SpanID(), read.Parent.SpanID())
+	require.Equal(t, "big.bin", spanAttr(read, tracing.AttrFileName).AsString())
+	require.Equal(t, int64(len(content)), spanAttr(read, tracing.AttrBytes).AsInt64())
+	require.Equal(t, int64(3), spanAttr(read, tracing.AttrChunks).AsInt64())
+
+	write := findSpan(t, spans, "file.write")
+	require.Equal(t, int64(5), spanAttr(write, tracing.AttrBytes).AsInt64())
+	require.Equal(t, int64(1), spanAttr(write, tracing.AttrChunks).AsInt64())
+}
+
+type tracedDownloadStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *tracedDownloadStream) Send(*pb.DownloadResponse) error {
+	return nil
+}
+
+func (s *tracedDownloadStream) Context() context.Context {
+	return s.ctx
+}
@@ -0,0 +1,89 @@
+package tests
+
+import (
+	"Tages/internal/cache"
+	"Tages/internal/metrics"
+	"Tages/internal/service"
+	pb "Tages/pkg"
+	"Tages/pkg/mocks"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/require"
+)
+
+func histogramCount(t *testing.T, h *prometheus.HistogramVec, method string) uint64 {
+	var m dto.Metric
+	require.NoError(t, h.WithLabelValues(method).(prometheus.Histogram).Write(&m))
+	return m.GetHistogram().GetSampleCount()
+}
+
+func TestTransferMetrics(t *testing.T) {
+	dir := t.TempDir()
+	viper.Set("upload.dir", dir)
+	logger := logrus.New()
+	c := cache.NewCache(logger, make(chan float64, 1))
+	srv, err := service.NewServicefile(context.Background(), logger, c, &mocks.MockStorage{})
+	require.NoError(t, err)
+
+	uploaded := testutil.ToFloat64(metrics.TransferBytes.WithLabelValues("UploadFileUnary"))
+	uploads := histogramCount(t, metrics.TransferFileSize, "UploadFileUnary")
+
+	_, err = srv.UploadFileUnary(context.Background(), &pb.UploadRequest{Filename: "a.txt", Data: []byte("hello")})
+	require.NoError(t, err)
+
+	require.Equal(t, uploaded+5, testutil.ToFloat64(metrics.TransferBytes.WithLabelValues("UploadFileUnary")))
+	require.Equal(t, uploads+1, histogramCount(t, metrics.TransferFileSize, "UploadFileUnary"))
+
+	content := make([]byte, 150*1024)
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "big.bin"), content, 0644))
+
+	downloaded := testutil.ToFloat64(metrics.TransferBytes.WithLabelValues("DownloadFileStream"))
+	chunkLatency := histogramCount(t, metrics.TransferChunkLatency, "DownloadFileStream")
+	throughput := histogramCount(t, metrics.TransferThroughput, "DownloadFileStream")
+
+	require.NoError(t, srv.DownloadFileStream(&pb.DownloadRequest{Filename: "big.bin"}, &mockDownloadStream{}))
+
+	require.Equal(t, downloaded+float64(len(content)), testutil.ToFloat64(metrics.TransferBytes.WithLabelValues("DownloadFileStream")))
+	require.Equal(t, chunkLatency+3, histogramCount(t, metrics.TransferChunkLatency, "DownloadFileStream"))
+	require.Equal(t, throughput+1, histogramCount(t, metrics.TransferThroughput, "DownloadFileStream"))
+
+	// неудачная загрузка не попадает в размеры файлов
+	sizes := histogramCount(t, metrics.TransferFileSize, "DownloadFileUnary")
+	_, err = srv.DownloadFileUnary(context.Background(), &pb.DownloadRequest{Filename: "missing.bin"})
+	require.Error(t, err)
+	require.Equal(t, sizes, histogramCount(t, metrics.TransferFileSize, "DownloadFileUnary"))
+}
+
+func TestUploadMetricsSkipFailedCommit(t *testing.T) {
+	viper.Set("upload.dir", t.TempDir())
+	logger := logrus.New()
+	c := cache.NewCache(logger, make(chan float64, 1))
+	mockStorage := &mocks.MockStorage{
+		WithInTransactionFn: func(ctx context.Context, tFunc func(ctx context.Context) error) error {
+			return errors.New("commit failed")
+		},
+	}
+	srv, err := service.NewServicefile(context.Background(), logger, c, mockStorage)
+	require.NoError(t, err)
+
+	unary := histogramCount(t, metrics.TransferFileSize, "UploadFileUnary")
+	_, err = srv.UploadFileUnary(context.Background(), &pb.UploadRequest{Filename: "a.txt", Data: []byte("hello")})
+	require.Error(t, err)
+	require.Equal(t, unary, histogramCount(t, metrics.TransferFileSize, "UploadFileUnary"))
+
+	stream := histogramCount(t, metrics.TransferFileSize, "UploadFileStream")
+	err = srv.UploadFileStream(&mockUploadStream{
+		reqs: []*pb.UploadRequest{{Filename: "b.txt", Data: []byte("hello")}},
+	})
+	require.Error(t, err)
+	require.Equal(t, stream, histogramCount(t, metrics.TransferFileSize, "UploadFileStream"))
+}
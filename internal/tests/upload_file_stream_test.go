@@ -8,10 +8,8 @@ import (
 	"testing"
 
 	"Tages/internal/cache"
-	"Tages/internal/dto"
 	"Tages/internal/service"
 	pb "Tages/pkg"
-	"Tages/pkg/mocks"
 
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/viper"
@@ -48,14 +46,9 @@ func TestUploadFileStream(t *testing.T) {
 	viper.Set("upload.dir", dir)
 
 	logger := logrus.New()
-	c := cache.NewCache(logger, make(chan bool, 1))
-	mockStorage := &mocks.MockStorage{
-		AddFileFn: func(ctx context.Context, f dto.File) error { return nil },
-		WithInTransactionFn: func(ctx context.Context, fn func(context.Context) error) error {
-			return fn(ctx)
-		},
-	}
-	srv, _ := service.NewServicefile(context.Background(), logger, c, mockStorage)
+	c := cache.NewCache(logger, make(chan float64, 1))
+	store := newSQLiteStorage(t)
+	srv, _ := service.NewServicefile(context.Background(), logger, c, store)
 
 	data := []byte("tetesttesttesttesttesttetesttesttesttesttesttesttesttestteststtetesttesttesttesttesttesttesttestteststtetesttesttesttesttesttesttesttestteststtetesttesttesttesttesttesttesttestteststtetesttesttesttesttesttesttesttestteststtesttesttesttestst")
 	stream := &mockUploadStream{
@@ -71,4 +64,8 @@ func TestUploadFileStream(t *testing.T) {
 
 	_, err = os.Stat(filepath.Join(dir, stream.resp.Name))
 	require.NoError(t, err)
+
+	f, err := store.GetFileByName(context.Background(), stream.resp.Name)
+	require.NoError(t, err)
+	require.Equal(t, int64(len(data)), f.Size)
 }
@@ -2,19 +2,21 @@ package tests
 
 import (
 	"Tages/internal/cache"
-	"Tages/internal/dto"
 	"Tages/internal/service"
 	pb "Tages/pkg"
 	"Tages/pkg/mocks"
 	"context"
 	"fmt"
 	"os"
+	"path/filepath"
 	"sync"
 	"testing"
 
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/viper"
 	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
 func TestUploadFileUnary(t *testing.T) {
@@ -23,16 +25,11 @@ func TestUploadFileUnary(t *testing.T) {
 
 	logger := logrus.New()
 
-	c := cache.NewCache(logger, make(chan bool, 1))
+	c := cache.NewCache(logger, make(chan float64, 1))
 
-	mockStorage := &mocks.MockStorage{
-		AddFileFn: func(ctx context.Context, f dto.File) error { return nil },
-		WithInTransactionFn: func(ctx context.Context, fn func(ctx context.Context) error) error {
-			return fn(ctx)
-		},
-	}
+	store := newSQLiteStorage(t)
 
-	srv, _ := service.NewServicefile(context.Background(), logger, c, mockStorage)
+	srv, _ := service.NewServicefile(context.Background(), logger, c, store)
 
 	imgData, _ := os.ReadFile("./cat.jpg")
 
@@ -47,6 +44,10 @@ func TestUploadFileUnary(t *testing.T) {
 
 	_, err = os.Stat(resp.Path)
 	require.NoError(t, err)
+
+	f, err := store.GetFileByName(context.Background(), filepath.Base(resp.Path))
+	require.NoError(t, err)
+	require.Equal(t, int64(len(imgData)), f.Size)
 }
 
 func TestUploadFileUnaryConcurrent(t *testing.T) {
@@ -55,14 +56,9 @@ func TestUploadFileUnaryConcurrent(t *testing.T) {
 	wg.Add(numGoroutines)
 
 	logger := logrus.New()
-	c := cache.NewCache(logger, make(chan bool, 1))
+	c := cache.NewCache(logger, make(chan float64, 1))
 
-	mockStorage := &mocks.MockStorage{
-		AddFileFn: func(ctx context.Context, f dto.File) error { return nil },
-		WithInTransactionFn: func(ctx context.Context, fn func(txCtx context.Context) error) error {
-			return fn(ctx)
-		},
-	}
+	store := newSQLiteStorage(t)
 
 	imgData, err := os.ReadFile("./cat.jpg")
 	require.NoError(t, err)
@@ -70,7 +66,8 @@ func TestUploadFileUnaryConcurrent(t *testing.T) {
 	dir := t.TempDir()
 	viper.Set("upload.dir", dir)
 
-	srv, err := service.NewServicefile(context.Background(), logger, c, mockStorage)
+	srv, err := service.NewServicefile(context.Background(), logger, c, store)
+	require.NoError(t, err)
 
 	for i := 0; i < numGoroutines; i++ {
 		go func(i int) {
@@ -92,4 +89,30 @@ func TestUploadFileUnaryConcurrent(t *testing.T) {
 	}
 
 	wg.Wait()
+
+	files, err := store.GetAllFiles(context.Background())
+	require.NoError(t, err)
+	require.Len(t, files, numGoroutines)
+}
+
+func TestUploadFileUnaryRejectsTooLarge(t *testing.T) {
+	dir := t.TempDir()
+	viper.Set("upload.dir", dir)
+
+	logger := logrus.New()
+	c := cache.NewCache(logger, make(chan float64, 1))
+	srv, err := service.NewServicefile(context.Background(), logger, c, &mocks.MockStorage{})
+	require.NoError(t, err)
+
+	srv.SetMaxFileSize(4)
+
+	_, err = srv.UploadFileUnary(context.Background(), &pb.UploadRequest{
+		Filename: "big.bin",
+		Data:     []byte("12345"),
+	})
+	require.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	require.Empty(t, entries)
 }
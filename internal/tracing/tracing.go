@@ -0,0 +1,121 @@
+package tracing
+
+import (
+	"context"
+	"os"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.34.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const tracerName = "Tages"
+
+// атрибуты спанов передачи файлов
+const (
+	AttrFileName = attribute.Key("file.name")
+	AttrBytes    = attribute.Key("file.bytes")
+	AttrChunks   = attribute.Key("file.chunks")
+)
+
+type Config struct {
+	// otlp, stdout или none
+	Exporter    string
+	Endpoint    string
+	Insecure    bool
+	ServiceName string
+	// доля сохраняемых трейсов без родителя, входящий sampled-флаг соблюдается
+	SampleRatio float64
+}
+
+func LoadConfig(v *viper.Viper) (Config, error) {
+	cfg := Config{
+		Exporter:    v.GetString("tracing.exporter"),
+		Endpoint:    v.GetString("tracing.endpoint"),
+		Insecure:    v.GetBool("tracing.insecure"),
+		ServiceName: v.GetString("tracing.service_name"),
+		SampleRatio: v.GetFloat64("tracing.sample_ratio"),
+	}
+
+	switch cfg.Exporter {
+	case "otlp", "stdout", "none":
+	default:
+		return Config{}, errors.Errorf("unknown tracing.exporter %q", cfg.Exporter)
+	}
+	if cfg.SampleRatio < 0 || cfg.SampleRatio > 1 {
+		return Config{}, errors.New("tracing.sample_ratio must be in [0, 1]")
+	}
+
+	return cfg, nil
+}
+
+// Setup настраивает глобальный TracerProvider и W3C-пропагацию.
+// Возвращаемая функция дописывает оставшиеся спаны при остановке.
+func Setup(ctx context.Context, cfg Config, logger *logrus.Logger) (func(context.Context) error, error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(
+		propagation.TraceContext{},
+		propagation.Baggage{},
+	))
+	otel.SetErrorHandler(otel.ErrorHandlerFunc(func(err error) {
+		logger.WithError(err).Warn("Tracing error")
+	}))
+
+	var exporter sdktrace.SpanExporter
+	var err error
+	switch cfg.Exporter {
+	case "none":
+		return func(context.Context) error { return nil }, nil
+	case "stdout":
+		exporter, err = stdouttrace.New(stdouttrace.WithWriter(os.Stdout))
+	case "otlp":
+		opts := []otlptracegrpc.Option{otlptracegrpc.WithEndpoint(cfg.Endpoint)}
+		if cfg.Insecure {
+			opts = append(opts, otlptracegrpc.WithInsecure())
+		}
+		exporter, err = otlptracegrpc.New(ctx, opts...)
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "cant create trace exporter")
+	}
+
+	res, err := resource.Merge(resource.Default(), resource.NewWithAttributes(
+		semconv.SchemaURL,
+		semconv.ServiceName(cfg.ServiceName),
+	))
+	if err != nil {
+		return nil, errors.Wrap(err, "cant build trace resource")
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(cfg.SampleRatio))),
+	)
+	otel.SetTracerProvider(provider)
+
+	return provider.Shutdown, nil
+}
+
+// Start открывает дочерний спан от спана в ctx
+func Start(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return otel.Tracer(tracerName).Start(ctx, name, trace.WithAttributes(attrs...))
+}
+
+// End закрывает спан, отмечая ошибку
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
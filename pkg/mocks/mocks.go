@@ -4,6 +4,7 @@ import (
 	"context"
 
 	"Tages/internal/dto"
+	"Tages/internal/storage"
 	pb "Tages/pkg"
 
 	"google.golang.org/grpc"
@@ -100,6 +101,7 @@ func (m *MockFileServiceClient) ListFiles(ctx context.Context, in *pb.ListReques
 type MockStorage struct {
 	AddFileFn           func(ctx context.Context, f dto.File) error
 	GetAllFilesFn       func(ctx context.Context) ([]dto.File, error)
+	GetFileByNameFn     func(ctx context.Context, name string) (dto.File, error)
 	WithInTransactionFn func(ctx context.Context, tFunc func(ctx context.Context) error) error
 }
 
@@ -117,6 +119,13 @@ func (m *MockStorage) GetAllFiles(ctx context.Context) ([]dto.File, error) {
 	return []dto.File{}, nil
 }
 
+func (m *MockStorage) GetFileByName(ctx context.Context, name string) (dto.File, error) {
+	if m.GetFileByNameFn != nil {
+		return m.GetFileByNameFn(ctx, name)
+	}
+	return dto.File{}, storage.ErrNotFound
+}
+
 func (m *MockStorage) WithInTransaction(ctx context.Context, tFunc func(ctx context.Context) error) error {
 	if m.WithInTransactionFn != nil {
 		return m.WithInTransactionFn(ctx, tFunc)
@@ -370,6 +370,250 @@ func (x *FileInfo) GetUpdatedAt() *timestamppb.Timestamp {
 	return nil
 }
 
+type AuditQueryRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	From          *timestamppb.Timestamp `protobuf:"bytes,1,opt,name=from,proto3" json:"from,omitempty"`
+	To            *timestamppb.Timestamp `protobuf:"bytes,2,opt,name=to,proto3" json:"to,omitempty"`
+	Actor         string                 `protobuf:"bytes,3,opt,name=actor,proto3" json:"actor,omitempty"`
+	FileName      string                 `protobuf:"bytes,4,opt,name=file_name,json=fileName,proto3" json:"file_name,omitempty"`
+	AfterId       int64                  `protobuf:"varint,5,opt,name=after_id,json=afterId,proto3" json:"after_id,omitempty"` // Курсор: id последнего полученного события
+	Limit         int32                  `protobuf:"varint,6,opt,name=limit,proto3" json:"limit,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *AuditQueryRequest) Reset() {
+	*x = AuditQueryRequest{}
+	mi := &file_service_proto_msgTypes[7]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *AuditQueryRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*AuditQueryRequest) ProtoMessage() {}
+
+func (x *AuditQueryRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_service_proto_msgTypes[7]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use AuditQueryRequest.ProtoReflect.Descriptor instead.
+func (*AuditQueryRequest) Descriptor() ([]byte, []int) {
+	return file_service_proto_rawDescGZIP(), []int{7}
+}
+
+func (x *AuditQueryRequest) GetFrom() *timestamppb.Timestamp {
+	if x != nil {
+		return x.From
+	}
+	return nil
+}
+
+func (x *AuditQueryRequest) GetTo() *timestamppb.Timestamp {
+	if x != nil {
+		return x.To
+	}
+	return nil
+}
+
+func (x *AuditQueryRequest) GetActor() string {
+	if x != nil {
+		return x.Actor
+	}
+	return ""
+}
+
+func (x *AuditQueryRequest) GetFileName() string {
+	if x != nil {
+		return x.FileName
+	}
+	return ""
+}
+
+func (x *AuditQueryRequest) GetAfterId() int64 {
+	if x != nil {
+		return x.AfterId
+	}
+	return 0
+}
+
+func (x *AuditQueryRequest) GetLimit() int32 {
+	if x != nil {
+		return x.Limit
+	}
+	return 0
+}
+
+type AuditQueryResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Events        []*AuditEvent          `protobuf:"bytes,1,rep,name=events,proto3" json:"events,omitempty"`
+	NextAfterId   int64                  `protobuf:"varint,2,opt,name=next_after_id,json=nextAfterId,proto3" json:"next_after_id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *AuditQueryResponse) Reset() {
+	*x = AuditQueryResponse{}
+	mi := &file_service_proto_msgTypes[8]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *AuditQueryResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*AuditQueryResponse) ProtoMessage() {}
+
+func (x *AuditQueryResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_service_proto_msgTypes[8]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use AuditQueryResponse.ProtoReflect.Descriptor instead.
+func (*AuditQueryResponse) Descriptor() ([]byte, []int) {
+	return file_service_proto_rawDescGZIP(), []int{8}
+}
+
+func (x *AuditQueryResponse) GetEvents() []*AuditEvent {
+	if x != nil {
+		return x.Events
+	}
+	return nil
+}
+
+func (x *AuditQueryResponse) GetNextAfterId() int64 {
+	if x != nil {
+		return x.NextAfterId
+	}
+	return 0
+}
+
+type AuditEvent struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Id            int64                  `protobuf:"varint,1,opt,name=id,proto3" json:"id,omitempty"`
+	OccurredAt    *timestamppb.Timestamp `protobuf:"bytes,2,opt,name=occurred_at,json=occurredAt,proto3" json:"occurred_at,omitempty"`
+	Actor         string                 `protobuf:"bytes,3,opt,name=actor,proto3" json:"actor,omitempty"`
+	Peer          string                 `protobuf:"bytes,4,opt,name=peer,proto3" json:"peer,omitempty"`
+	Method        string                 `protobuf:"bytes,5,opt,name=method,proto3" json:"method,omitempty"`
+	FileName      string                 `protobuf:"bytes,6,opt,name=file_name,json=fileName,proto3" json:"file_name,omitempty"`
+	Bytes         int64                  `protobuf:"varint,7,opt,name=bytes,proto3" json:"bytes,omitempty"`
+	Code          string                 `protobuf:"bytes,8,opt,name=code,proto3" json:"code,omitempty"`
+	LatencyUs     int64                  `protobuf:"varint,9,opt,name=latency_us,json=latencyUs,proto3" json:"latency_us,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *AuditEvent) Reset() {
+	*x = AuditEvent{}
+	mi := &file_service_proto_msgTypes[9]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *AuditEvent) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*AuditEvent) ProtoMessage() {}
+
+func (x *AuditEvent) ProtoReflect() protoreflect.Message {
+	mi := &file_service_proto_msgTypes[9]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use AuditEvent.ProtoReflect.Descriptor instead.
+func (*AuditEvent) Descriptor() ([]byte, []int) {
+	return file_service_proto_rawDescGZIP(), []int{9}
+}
+
+func (x *AuditEvent) GetId() int64 {
+	if x != nil {
+		return x.Id
+	}
+	return 0
+}
+
+func (x *AuditEvent) GetOccurredAt() *timestamppb.Timestamp {
+	if x != nil {
+		return x.OccurredAt
+	}
+	return nil
+}
+
+func (x *AuditEvent) GetActor() string {
+	if x != nil {
+		return x.Actor
+	}
+	return ""
+}
+
+func (x *AuditEvent) GetPeer() string {
+	if x != nil {
+		return x.Peer
+	}
+	return ""
+}
+
+func (x *AuditEvent) GetMethod() string {
+	if x != nil {
+		return x.Method
+	}
+	return ""
+}
+
+func (x *AuditEvent) GetFileName() string {
+	if x != nil {
+		return x.FileName
+	}
+	return ""
+}
+
+func (x *AuditEvent) GetBytes() int64 {
+	if x != nil {
+		return x.Bytes
+	}
+	return 0
+}
+
+func (x *AuditEvent) GetCode() string {
+	if x != nil {
+		return x.Code
+	}
+	return ""
+}
+
+func (x *AuditEvent) GetLatencyUs() int64 {
+	if x != nil {
+		return x.LatencyUs
+	}
+	return 0
+}
+
 var File_service_proto protoreflect.FileDescriptor
 
 const file_service_proto_rawDesc = "" +
@@ -395,13 +639,38 @@ const file_service_proto_rawDesc = "" +
 	"\n" +
 	"created_at\x18\x03 \x01(\v2\x1a.google.protobuf.TimestampR\tcreatedAt\x129\n" +
 	"\n" +
-	"updated_at\x18\x04 \x01(\v2\x1a.google.protobuf.TimestampR\tupdatedAt2\xa5\x03\n" +
+	"updated_at\x18\x04 \x01(\v2\x1a.google.protobuf.TimestampR\tupdatedAt\"\xd3\x01\n" +
+	"\x11AuditQueryRequest\x12.\n" +
+	"\x04from\x18\x01 \x01(\v2\x1a.google.protobuf.TimestampR\x04from\x12*\n" +
+	"\x02to\x18\x02 \x01(\v2\x1a.google.protobuf.TimestampR\x02to\x12\x14\n" +
+	"\x05actor\x18\x03 \x01(\tR\x05actor\x12\x1b\n" +
+	"\tfile_name\x18\x04 \x01(\tR\bfileName\x12\x19\n" +
+	"\bafter_id\x18\x05 \x01(\x03R\aafterId\x12\x14\n" +
+	"\x05limit\x18\x06 \x01(\x05R\x05limit\"k\n" +
+	"\x12AuditQueryResponse\x121\n" +
+	"\x06events\x18\x01 \x03(\v2\x19.tages.service.AuditEventR\x06events\x12\"\n" +
+	"\rnext_after_id\x18\x02 \x01(\x03R\vnextAfterId\"\x81\x02\n" +
+	"\n" +
+	"AuditEvent\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\x03R\x02id\x12;\n" +
+	"\voccurred_at\x18\x02 \x01(\v2\x1a.google.protobuf.TimestampR\n" +
+	"occurredAt\x12\x14\n" +
+	"\x05actor\x18\x03 \x01(\tR\x05actor\x12\x12\n" +
+	"\x04peer\x18\x04 \x01(\tR\x04peer\x12\x16\n" +
+	"\x06method\x18\x05 \x01(\tR\x06method\x12\x1b\n" +
+	"\tfile_name\x18\x06 \x01(\tR\bfileName\x12\x14\n" +
+	"\x05bytes\x18\a \x01(\x03R\x05bytes\x12\x12\n" +
+	"\x04code\x18\b \x01(\tR\x04code\x12\x1d\n" +
+	"\n" +
+	"latency_us\x18\t \x01(\x03R\tlatencyUs2\xa5\x03\n" +
 	"\vFileService\x12Q\n" +
 	"\x10UploadFileStream\x12\x1c.tages.service.UploadRequest\x1a\x1d.tages.service.UploadResponse(\x01\x12N\n" +
 	"\x0fUploadFileUnary\x12\x1c.tages.service.UploadRequest\x1a\x1d.tages.service.UploadResponse\x12W\n" +
 	"\x12DownloadFileStream\x12\x1e.tages.service.DownloadRequest\x1a\x1f.tages.service.DownloadResponse0\x01\x12T\n" +
 	"\x11DownloadFileUnary\x12\x1e.tages.service.DownloadRequest\x1a\x1f.tages.service.DownloadResponse\x12D\n" +
-	"\tListFiles\x12\x1a.tages.service.ListRequest\x1a\x1b.tages.service.ListResponseB\vZ\tTages/pkgb\x06proto3"
+	"\tListFiles\x12\x1a.tages.service.ListRequest\x1a\x1b.tages.service.ListResponse2d\n" +
+	"\fAuditService\x12T\n" +
+	"\rQueryAuditLog\x12 .tages.service.AuditQueryRequest\x1a!.tages.service.AuditQueryResponseB\vZ\tTages/pkgb\x06proto3"
 
 var (
 	file_service_proto_rawDescOnce sync.Once
@@ -415,7 +684,7 @@ func file_service_proto_rawDescGZIP() []byte {
 	return file_service_proto_rawDescData
 }
 
-var file_service_proto_msgTypes = make([]protoimpl.MessageInfo, 7)
+var file_service_proto_msgTypes = make([]protoimpl.MessageInfo, 10)
 var file_service_proto_goTypes = []any{
 	(*UploadRequest)(nil),         // 0: tages.service.UploadRequest
 	(*UploadResponse)(nil),        // 1: tages.service.UploadResponse
@@ -424,27 +693,36 @@ var file_service_proto_goTypes = []any{
 	(*ListRequest)(nil),           // 4: tages.service.ListRequest
 	(*ListResponse)(nil),          // 5: tages.service.ListResponse
 	(*FileInfo)(nil),              // 6: tages.service.FileInfo
-	(*timestamppb.Timestamp)(nil), // 7: google.protobuf.Timestamp
+	(*AuditQueryRequest)(nil),     // 7: tages.service.AuditQueryRequest
+	(*AuditQueryResponse)(nil),    // 8: tages.service.AuditQueryResponse
+	(*AuditEvent)(nil),            // 9: tages.service.AuditEvent
+	(*timestamppb.Timestamp)(nil), // 10: google.protobuf.Timestamp
 }
 var file_service_proto_depIdxs = []int32{
-	6, // 0: tages.service.ListResponse.files:type_name -> tages.service.FileInfo
-	7, // 1: tages.service.FileInfo.created_at:type_name -> google.protobuf.Timestamp
-	7, // 2: tages.service.FileInfo.updated_at:type_name -> google.protobuf.Timestamp
-	0, // 3: tages.service.FileService.UploadFileStream:input_type -> tages.service.UploadRequest
-	0, // 4: tages.service.FileService.UploadFileUnary:input_type -> tages.service.UploadRequest
-	2, // 5: tages.service.FileService.DownloadFileStream:input_type -> tages.service.DownloadRequest
-	2, // 6: tages.service.FileService.DownloadFileUnary:input_type -> tages.service.DownloadRequest
-	4, // 7: tages.service.FileService.ListFiles:input_type -> tages.service.ListRequest
-	1, // 8: tages.service.FileService.UploadFileStream:output_type -> tages.service.UploadResponse
-	1, // 9: tages.service.FileService.UploadFileUnary:output_type -> tages.service.UploadResponse
-	3, // 10: tages.service.FileService.DownloadFileStream:output_type -> tages.service.DownloadResponse
-	3, // 11: tages.service.FileService.DownloadFileUnary:output_type -> tages.service.DownloadResponse
-	5, // 12: tages.service.FileService.ListFiles:output_type -> tages.service.ListResponse
-	8, // [8:13] is the sub-list for method output_type
-	3, // [3:8] is the sub-list for method input_type
-	3, // [3:3] is the sub-list for extension type_name
-	3, // [3:3] is the sub-list for extension extendee
-	0, // [0:3] is the sub-list for field type_name
+	6,  // 0: tages.service.ListResponse.files:type_name -> tages.service.FileInfo
+	10, // 1: tages.service.FileInfo.created_at:type_name -> google.protobuf.Timestamp
+	10, // 2: tages.service.FileInfo.updated_at:type_name -> google.protobuf.Timestamp
+	10, // 3: tages.service.AuditQueryRequest.from:type_name -> google.protobuf.Timestamp
+	10, // 4: tages.service.AuditQueryRequest.to:type_name -> google.protobuf.Timestamp
+	9,  // 5: tages.service.AuditQueryResponse.events:type_name -> tages.service.AuditEvent
+	10, // 6: tages.service.AuditEvent.occurred_at:type_name -> google.protobuf.Timestamp
+	0,  // 7: tages.service.FileService.UploadFileStream:input_type -> tages.service.UploadRequest
+	0,  // 8: tages.service.FileService.UploadFileUnary:input_type -> tages.service.UploadRequest
+	2,  // 9: tages.service.FileService.DownloadFileStream:input_type -> tages.service.DownloadRequest
+	2,  // 10: tages.service.FileService.DownloadFileUnary:input_type -> tages.service.DownloadRequest
+	4,  // 11: tages.service.FileService.ListFiles:input_type -> tages.service.ListRequest
+	7,  // 12: tages.service.AuditService.QueryAuditLog:input_type -> tages.service.AuditQueryRequest
+	1,  // 13: tages.service.FileService.UploadFileStream:output_type -> tages.service.UploadResponse
+	1,  // 14: tages.service.FileService.UploadFileUnary:output_type -> tages.service.UploadResponse
+	3,  // 15: tages.service.FileService.DownloadFileStream:output_type -> tages.service.DownloadResponse
+	3,  // 16: tages.service.FileService.DownloadFileUnary:output_type -> tages.service.DownloadResponse
+	5,  // 17: tages.service.FileService.ListFiles:output_type -> tages.service.ListResponse
+	8,  // 18: tages.service.AuditService.QueryAuditLog:output_type -> tages.service.AuditQueryResponse
+	13, // [13:19] is the sub-list for method output_type
+	7,  // [7:13] is the sub-list for method input_type
+	7,  // [7:7] is the sub-list for extension type_name
+	7,  // [7:7] is the sub-list for extension extendee
+	0,  // [0:7] is the sub-list for field type_name
 }
 
 func init() { file_service_proto_init() }
@@ -458,9 +736,9 @@ func file_service_proto_init() {
 			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
 			RawDescriptor: unsafe.Slice(unsafe.StringData(file_service_proto_rawDesc), len(file_service_proto_rawDesc)),
 			NumEnums:      0,
-			NumMessages:   7,
+			NumMessages:   10,
 			NumExtensions: 0,
-			NumServices:   1,
+			NumServices:   2,
 		},
 		GoTypes:           file_service_proto_goTypes,
 		DependencyIndexes: file_service_proto_depIdxs,